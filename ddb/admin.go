@@ -19,7 +19,29 @@ func NewAdmin(ddbClient *dynamodb.Client) *Admin {
 	}
 }
 
-func (a *Admin) CreateTable(tableName string) error {
+type TableOption func(*tableOptions)
+
+type tableOptions struct {
+	streamViewType types.StreamViewType
+}
+
+// WithStreamViewType sets what the table's stream records carry. By default
+// they only carry the keys of the changed item; use
+// types.StreamViewTypeNewAndOldImages to receive the items as well.
+func WithStreamViewType(streamViewType types.StreamViewType) TableOption {
+	return func(o *tableOptions) {
+		o.streamViewType = streamViewType
+	}
+}
+
+func (a *Admin) CreateTable(tableName string, opts ...TableOption) error {
+	options := tableOptions{
+		streamViewType: types.StreamViewTypeKeysOnly,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	_, err := a.client.CreateTable(context.Background(), &dynamodb.CreateTableInput{
 		TableName: &tableName,
 		AttributeDefinitions: []types.AttributeDefinition{
@@ -64,7 +86,7 @@ func (a *Admin) CreateTable(tableName string) error {
 		},
 		StreamSpecification: &types.StreamSpecification{
 			StreamEnabled:  aws.Bool(true),
-			StreamViewType: types.StreamViewTypeKeysOnly,
+			StreamViewType: options.streamViewType,
 		},
 	})
 	if err != nil {
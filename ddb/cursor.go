@@ -0,0 +1,203 @@
+package ddb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidCursor is returned by QueryPage for a cursor that was tampered
+// with, or minted for a different query or table.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// QueryPage runs a single page of the query, starting after cursor, and returns
+// the items along with the cursor of the next page. An empty cursor starts
+// from the beginning, and an empty next cursor means there are no more pages.
+// The page size is set by input.Limit; a page may hold fewer items, or none,
+// when a filter expression drops them.
+//
+// Cursors are opaque base64 tokens, signed with the WithCursorKey secret.
+func (s *Store) QueryPage(ctx context.Context, input *dynamodb.QueryInput, cursor string) ([]map[string]types.AttributeValue, string, error) {
+	if len(s.cursorKey) == 0 {
+		return nil, "", fmt.Errorf("unable to query page: no cursor key, see WithCursorKey")
+	}
+
+	input.TableName = s.tableName
+	input.ExclusiveStartKey = nil
+	if cursor != "" {
+		key, err := s.decodeCursor(input, cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		input.ExclusiveStartKey = key
+	}
+
+	out, err := s.client.Query(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("ddb.Query: %w", mapError(err))
+	}
+
+	var next string
+	if len(out.LastEvaluatedKey) > 0 {
+		next, err = s.encodeCursor(input, out.LastEvaluatedKey)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return out.Items, next, nil
+}
+
+// cursorValue is a key attribute in a cursor. Key attributes can only be
+// strings, numbers or binary.
+type cursorValue struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+func (s *Store) encodeCursor(input *dynamodb.QueryInput, key map[string]types.AttributeValue) (string, error) {
+	values := make(map[string]cursorValue, len(key))
+	for name, av := range key {
+		switch v := av.(type) {
+		case *types.AttributeValueMemberS:
+			values[name] = cursorValue{S: aws.String(v.Value)}
+		case *types.AttributeValueMemberN:
+			values[name] = cursorValue{N: aws.String(v.Value)}
+		case *types.AttributeValueMemberB:
+			values[name] = cursorValue{B: v.Value}
+		default:
+			return "", fmt.Errorf("unable to encode cursor: unsupported key attribute type %T for %v", av, name)
+		}
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(s.signCursor(input, payload)), nil
+}
+
+func (s *Store) decodeCursor(input *dynamodb.QueryInput, cursor string) (map[string]types.AttributeValue, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	if !hmac.Equal(signature, s.signCursor(input, payload)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidCursor)
+	}
+
+	var values map[string]cursorValue
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	key := make(map[string]types.AttributeValue, len(values))
+	for name, v := range values {
+		switch {
+		case v.S != nil:
+			key[name] = &types.AttributeValueMemberS{Value: *v.S}
+		case v.N != nil:
+			key[name] = &types.AttributeValueMemberN{Value: *v.N}
+		default:
+			key[name] = &types.AttributeValueMemberB{Value: v.B}
+		}
+	}
+
+	return key, nil
+}
+
+// signCursor signs the payload together with the table and query it was
+// minted for, so it can't be replayed against another one.
+func (s *Store) signCursor(input *dynamodb.QueryInput, payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.cursorKey)
+	writeQuery(mac, input)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// writeQuery writes the parts of input that select its results, leaving out
+// the page size and start key.
+func writeQuery(w io.Writer, input *dynamodb.QueryInput) {
+	for _, s := range []*string{input.TableName, input.IndexName, input.KeyConditionExpression, input.FilterExpression, input.ProjectionExpression} {
+		fmt.Fprintf(w, "%q;", aws.ToString(s))
+	}
+	fmt.Fprintf(w, "%v;%q;", input.ScanIndexForward == nil || *input.ScanIndexForward, input.Select)
+
+	for _, name := range sortedKeys(input.ExpressionAttributeNames) {
+		fmt.Fprintf(w, "%q=%q;", name, input.ExpressionAttributeNames[name])
+	}
+	for _, name := range sortedKeys(input.ExpressionAttributeValues) {
+		fmt.Fprintf(w, "%q=", name)
+		writeAttributeValue(w, input.ExpressionAttributeValues[name])
+		fmt.Fprint(w, ";")
+	}
+}
+
+func writeAttributeValue(w io.Writer, av types.AttributeValue) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		fmt.Fprintf(w, "S%q", v.Value)
+	case *types.AttributeValueMemberN:
+		fmt.Fprintf(w, "N%q", v.Value)
+	case *types.AttributeValueMemberB:
+		fmt.Fprintf(w, "B%q", v.Value)
+	case *types.AttributeValueMemberBOOL:
+		fmt.Fprintf(w, "BOOL%v", v.Value)
+	case *types.AttributeValueMemberNULL:
+		fmt.Fprint(w, "NULL")
+	case *types.AttributeValueMemberSS:
+		fmt.Fprintf(w, "SS%q", v.Value)
+	case *types.AttributeValueMemberNS:
+		fmt.Fprintf(w, "NS%q", v.Value)
+	case *types.AttributeValueMemberBS:
+		fmt.Fprintf(w, "BS%q", v.Value)
+	case *types.AttributeValueMemberL:
+		fmt.Fprint(w, "L[")
+		for _, item := range v.Value {
+			writeAttributeValue(w, item)
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "]")
+	case *types.AttributeValueMemberM:
+		fmt.Fprint(w, "M{")
+		for _, name := range sortedKeys(v.Value) {
+			fmt.Fprintf(w, "%q:", name)
+			writeAttributeValue(w, v.Value[name])
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprint(w, "}")
+	default:
+		fmt.Fprintf(w, "%T", av)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,81 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func newUserQuery(org string) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": &types.AttributeValueMemberS{Value: org}},
+		Limit:                     aws.Int32(2),
+	}
+}
+
+func TestStore_QueryPage(t *testing.T) {
+	var calls int
+	store := newTestStore(t, pagedQuery(t, 5, 2, &calls), WithCursorKey([]byte("secret")))
+
+	var skeys []string
+	var cursor string
+	for {
+		items, next, err := store.QueryPage(context.Background(), newUserQuery("org-1"), cursor)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		for _, item := range items {
+			skeys = append(skeys, item["SK"].(*types.AttributeValueMemberS).Value)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if got, want := strings.Join(skeys, ","), "0,1,2,3,4"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestStore_QueryPage_invalid(t *testing.T) {
+	var calls int
+	store := newTestStore(t, pagedQuery(t, 5, 2, &calls), WithCursorKey([]byte("secret")))
+
+	_, cursor, err := store.QueryPage(context.Background(), newUserQuery("org-1"), "")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	otherTable := *store
+	otherTable.tableName = aws.String("other")
+	otherKey := *store
+	otherKey.cursorKey = []byte("other")
+
+	testCases := map[string]struct {
+		store  *Store
+		input  *dynamodb.QueryInput
+		cursor string
+	}{
+		"other query": {store: store, input: newUserQuery("org-2"), cursor: cursor},
+		"other table": {store: &otherTable, input: newUserQuery("org-1"), cursor: cursor},
+		"other key":   {store: &otherKey, input: newUserQuery("org-1"), cursor: cursor},
+		"tampered":    {store: store, input: newUserQuery("org-1"), cursor: "e30" + cursor[strings.Index(cursor, "."):]},
+		"malformed":   {store: store, input: newUserQuery("org-1"), cursor: "not a cursor"},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			_, _, err := tc.store.QueryPage(context.Background(), tc.input, tc.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("got %v; want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
@@ -4,27 +4,46 @@ package ddblocal
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/code-inbox/mason-go/awslocal"
 	"github.com/code-inbox/mason-go/ddb"
+	"github.com/code-inbox/mason-go/internal/logging"
 	"github.com/ory/dockertest"
 )
 
 type Config struct {
-	port  string
-	tag   string
-	image string
+	port   string
+	tag    string
+	image  string
+	logger *slog.Logger
 }
 
-func NewConfig(image string, tag string, port string) *Config {
-	return &Config{
+type Option func(*Config)
+
+// WithLogger sets the logger used while starting the container. By default
+// nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Config) {
+		c.logger = logger
+	}
+}
+
+func NewConfig(image string, tag string, port string, opts ...Option) *Config {
+	c := &Config{
 		port:  port,
 		tag:   tag,
 		image: image,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.logger = logging.OrDiscard(c.logger)
+
+	return c
 }
 
 func (c *Config) Start() (*dockertest.Resource, *dynamodbstreams.Client, *dynamodb.Client, error) {
@@ -34,18 +53,19 @@ func (c *Config) Start() (*dockertest.Resource, *dynamodbstreams.Client, *dynamo
 
 	d, err := dockertest.NewPool("")
 	if err != nil {
-		log.Fatalf("Could not construct pool: %s", err)
+		return nil, nil, nil, fmt.Errorf("dockertest.NewPool: %w", err)
 	}
 
 	err = d.Client.Ping()
 	if err != nil {
-		log.Fatalf("Could not connect to Docker: %s", err)
+		return nil, nil, nil, fmt.Errorf("docker ping: %w", err)
 	}
 
 	// pulls an image, creates a container based on it and runs it
+	c.logger.Debug("starting container", "image", image, "tag", tag)
 	ddbResource, err := d.Run(image, tag, args)
 	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
+		return nil, nil, nil, fmt.Errorf("dockertest.Run: %w", err)
 	}
 
 	var ddbStreamsClient *dynamodbstreams.Client
@@ -54,6 +74,7 @@ func (c *Config) Start() (*dockertest.Resource, *dynamodbstreams.Client, *dynamo
 		tableName := "ping-test"
 
 		port := ddbResource.GetPort("8000/tcp")
+		c.logger.Debug("pinging dynamodb", "port", port)
 
 		cfg, err := awslocal.NewConfig("localhost", port)
 		if err != nil {
@@ -79,8 +100,10 @@ func (c *Config) Start() (*dockertest.Resource, *dynamodbstreams.Client, *dynamo
 
 	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
 	if err := d.Retry(ping); err != nil {
-		return ddbResource, ddbStreamsClient, ddbClient, fmt.Errorf("pgstore in docker failed to ping: %w", err)
+		return ddbResource, ddbStreamsClient, ddbClient, fmt.Errorf("dynamodb in docker failed to ping: %w", err)
 	}
 
+	c.logger.Info("dynamodb started", "port", ddbResource.GetPort("8000/tcp"))
+
 	return ddbResource, ddbStreamsClient, ddbClient, nil
 }
@@ -0,0 +1,130 @@
+package ddbstream
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// ToStreamAttributeValues converts the keys or image of a Lambda DynamoDB
+// event record to the attribute values read from DynamoDB Streams, preserving
+// every attribute and its type. A nil map is returned as nil, as the stream
+// does for images it does not carry.
+func ToStreamAttributeValues(m map[string]events.DynamoDBAttributeValue) map[string]types.AttributeValue {
+	if m == nil {
+		return nil
+	}
+
+	values := make(map[string]types.AttributeValue, len(m))
+	for k, v := range m {
+		values[k] = ToStreamAttributeValue(v)
+	}
+	return values
+}
+
+// ToStreamAttributeValue converts a single attribute value of a Lambda DynamoDB
+// event record to the attribute value read from DynamoDB Streams.
+func ToStreamAttributeValue(av events.DynamoDBAttributeValue) types.AttributeValue {
+	switch av.DataType() {
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: av.Binary()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: av.Boolean()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: av.BinarySet()}
+	case events.DataTypeList:
+		list := make([]types.AttributeValue, 0, len(av.List()))
+		for _, item := range av.List() {
+			list = append(list, ToStreamAttributeValue(item))
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	case events.DataTypeMap:
+		values := ToStreamAttributeValues(av.Map())
+		if values == nil {
+			values = map[string]types.AttributeValue{}
+		}
+		return &types.AttributeValueMemberM{Value: values}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: av.Number()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: av.NumberSet()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: av.StringSet()}
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: av.String()}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
+
+// ToEventAttributeValues converts attribute values read from DynamoDB Streams
+// to those of a Lambda DynamoDB event, the reverse of ToStreamAttributeValues.
+func ToEventAttributeValues(m map[string]types.AttributeValue) map[string]events.DynamoDBAttributeValue {
+	if m == nil {
+		return nil
+	}
+
+	values := make(map[string]events.DynamoDBAttributeValue, len(m))
+	for k, v := range m {
+		values[k] = ToEventAttributeValue(v)
+	}
+	return values
+}
+
+// ToEventAttributeValue converts a single attribute value read from DynamoDB
+// Streams to that of a Lambda DynamoDB event.
+func ToEventAttributeValue(av types.AttributeValue) events.DynamoDBAttributeValue {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value)
+	case *types.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value)
+	case *types.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value)
+	case *types.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value)
+	case *types.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value)
+	case *types.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value)
+	case *types.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, 0, len(v.Value))
+		for _, item := range v.Value {
+			list = append(list, ToEventAttributeValue(item))
+		}
+		return events.NewListAttribute(list)
+	case *types.AttributeValueMemberM:
+		return events.NewMapAttribute(ToEventAttributeValues(v.Value))
+	default:
+		return events.NewNullAttribute()
+	}
+}
+
+// ToEventRecord converts a record read from DynamoDB Streams into the shape
+// Lambda delivers, the reverse of what the Lambda adapter does.
+func ToEventRecord(streamARN string, r *types.Record) events.DynamoDBEventRecord {
+	record := events.DynamoDBEventRecord{
+		AWSRegion:      aws.ToString(r.AwsRegion),
+		EventID:        aws.ToString(r.EventID),
+		EventName:      string(r.EventName),
+		EventSource:    aws.ToString(r.EventSource),
+		EventSourceArn: streamARN,
+		EventVersion:   aws.ToString(r.EventVersion),
+	}
+
+	if change := r.Dynamodb; change != nil {
+		record.Change = events.DynamoDBStreamRecord{
+			ApproximateCreationDateTime: events.SecondsEpochTime{Time: aws.ToTime(change.ApproximateCreationDateTime)},
+			Keys:                        ToEventAttributeValues(change.Keys),
+			NewImage:                    ToEventAttributeValues(change.NewImage),
+			OldImage:                    ToEventAttributeValues(change.OldImage),
+			SequenceNumber:              aws.ToString(change.SequenceNumber),
+			SizeBytes:                   aws.ToInt64(change.SizeBytes),
+			StreamViewType:              string(change.StreamViewType),
+		}
+	}
+
+	return record
+}
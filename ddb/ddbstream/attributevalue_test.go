@@ -0,0 +1,57 @@
+package ddbstream
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func Test_ToStreamAttributeValues(t *testing.T) {
+	data := `{
+		"S": {"S": "hello"},
+		"N": {"N": "42"},
+		"B": {"B": "aGVsbG8="},
+		"BOOL": {"BOOL": true},
+		"NULL": {"NULL": true},
+		"L": {"L": [{"S": "a"}, {"N": "1"}]},
+		"M": {"M": {"nested": {"S": "b"}}},
+		"SS": {"SS": ["a", "b"]},
+		"NS": {"NS": ["1", "2"]},
+		"BS": {"BS": ["aGVsbG8="]}
+	}`
+
+	var image map[string]events.DynamoDBAttributeValue
+	if err := json.Unmarshal([]byte(data), &image); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	want := map[string]types.AttributeValue{
+		"S":    &types.AttributeValueMemberS{Value: "hello"},
+		"N":    &types.AttributeValueMemberN{Value: "42"},
+		"B":    &types.AttributeValueMemberB{Value: []byte("hello")},
+		"BOOL": &types.AttributeValueMemberBOOL{Value: true},
+		"NULL": &types.AttributeValueMemberNULL{Value: true},
+		"L": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberS{Value: "a"},
+			&types.AttributeValueMemberN{Value: "1"},
+		}},
+		"M": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"nested": &types.AttributeValueMemberS{Value: "b"},
+		}},
+		"SS": &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"NS": &types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		"BS": &types.AttributeValueMemberBS{Value: [][]byte{[]byte("hello")}},
+	}
+
+	got := ToStreamAttributeValues(image)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if got := ToStreamAttributeValues(nil); got != nil {
+		t.Fatalf("got %v; want nil", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Package ddbstream defines the contract for processing DynamoDB stream records,
+// shared by the Lambda adapter and the local listener so the same processing
+// code runs in both.
+package ddbstream
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// Metadata describes where a batch of records was read from.
+type Metadata struct {
+	// StreamARN is the ARN of the stream the records were read from.
+	StreamARN string
+
+	// ShardID is the shard the records were read from. Lambda does not report
+	// it, so it is empty when running in Lambda.
+	ShardID string
+}
+
+// Batch is a batch of records read from a single shard, in order.
+type Batch struct {
+	Metadata
+	Records []*types.Record
+}
+
+// Processor processes batches of stream records. Records that fail are
+// reported in the response by their sequence number, so that only they, and
+// the records after them, are retried; an error fails the whole batch.
+type Processor interface {
+	Process(ctx context.Context, batch Batch) (events.DynamoDBEventResponse, error)
+}
+
+// ProcessorFunc adapts a func to a Processor.
+type ProcessorFunc func(ctx context.Context, batch Batch) (events.DynamoDBEventResponse, error)
+
+func (fn ProcessorFunc) Process(ctx context.Context, batch Batch) (events.DynamoDBEventResponse, error) {
+	return fn(ctx, batch)
+}
+
+// RecordsFunc adapts a func that processes records, and fails the whole batch
+// on error, to a Processor.
+type RecordsFunc func(ctx context.Context, records []*types.Record) error
+
+func (fn RecordsFunc) Process(ctx context.Context, batch Batch) (events.DynamoDBEventResponse, error) {
+	return events.DynamoDBEventResponse{}, fn(ctx, batch.Records)
+}
+
+type metadataKey struct{}
+
+// NewContext returns a copy of ctx carrying md.
+func NewContext(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// FromContext returns the metadata of the batch being processed, if any.
+func FromContext(ctx context.Context) (Metadata, bool) {
+	md, ok := ctx.Value(metadataKey{}).(Metadata)
+	return md, ok
+}
@@ -0,0 +1,47 @@
+package ddb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrNotFound is returned when the item doesn't exist.
+	ErrNotFound = errors.New("item not found")
+
+	// ErrAlreadyExists is returned by Create when an item with the same keys
+	// exists. It is also an ErrConditionFailed.
+	ErrAlreadyExists = errors.New("item already exists")
+
+	// ErrConditionFailed is returned when a write's condition isn't met.
+	ErrConditionFailed = errors.New("condition failed")
+
+	// ErrThrottled is returned when DynamoDB rejects a request for exceeding
+	// the table's throughput or the account's request limits.
+	ErrThrottled = errors.New("throttled")
+
+	// ErrVersionConflict is returned by Save and Replace when a Versioned item
+	// was changed or deleted by another writer since it was read. It is also
+	// an ErrConditionFailed.
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// mapError wraps err with the sentinel error matching the DynamoDB error it
+// carries, keeping err in the chain.
+func mapError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.ErrorCode() {
+	case "ConditionalCheckFailedException":
+		return fmt.Errorf("%w: %w", ErrConditionFailed, err)
+	case "ThrottlingException", "RequestLimitExceeded", "ProvisionedThroughputExceededException":
+		return fmt.Errorf("%w: %w", ErrThrottled, err)
+	}
+
+	return err
+}
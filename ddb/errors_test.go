@@ -0,0 +1,67 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func awsError(code string) (int, interface{}) {
+	return http.StatusBadRequest, map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + code,
+		"message": code,
+	}
+}
+
+func TestStore_errors(t *testing.T) {
+	testCases := map[string]struct {
+		respond  func() (int, interface{})
+		call     func(s *Store) error
+		wantErrs []error
+	}{
+		"fetch missing item": {
+			respond: func() (int, interface{}) { return http.StatusOK, map[string]interface{}{} },
+			call: func(s *Store) error {
+				_, err := s.Fetch(context.Background(), "pk", "sk")
+				return err
+			},
+			wantErrs: []error{ErrNotFound},
+		},
+		"discard missing item": {
+			respond:  func() (int, interface{}) { return awsError("ConditionalCheckFailedException") },
+			call:     func(s *Store) error { return s.Discard(context.Background(), "pk", "sk") },
+			wantErrs: []error{ErrNotFound, ErrConditionFailed},
+		},
+		"save condition failed": {
+			respond:  func() (int, interface{}) { return awsError("ConditionalCheckFailedException") },
+			call:     func(s *Store) error { return s.Save(context.Background(), testUser{PK: "pk", SK: "sk"}) },
+			wantErrs: []error{ErrConditionFailed},
+		},
+		"query throttled": {
+			respond: func() (int, interface{}) { return awsError("ProvisionedThroughputExceededException") },
+			call: func(s *Store) error {
+				_, err := s.QueryAll(context.Background(), &dynamodb.QueryInput{})
+				return err
+			},
+			wantErrs: []error{ErrThrottled},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store := newTestStore(t, func(string, map[string]interface{}) (int, interface{}) {
+				return tc.respond()
+			})
+
+			err := tc.call(store)
+			for _, want := range tc.wantErrs {
+				if !errors.Is(err, want) {
+					t.Fatalf("got %v; want %v", err, want)
+				}
+			}
+		})
+	}
+}
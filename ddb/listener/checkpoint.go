@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/code-inbox/mason-go/ddb"
+)
+
+// CheckpointStore records the last sequence number acknowledged for each shard
+// so a Subscriber can resume where it left off after a restart.
+type CheckpointStore interface {
+	// GetCheckpoint returns the last acknowledged sequence number for the shard or
+	// an empty string if none has been recorded.
+	GetCheckpoint(ctx context.Context, streamARN, shardID string) (string, error)
+
+	// SetCheckpoint records sequenceNumber as the last acknowledged record of the shard.
+	SetCheckpoint(ctx context.Context, streamARN, shardID, sequenceNumber string) error
+}
+
+// MemoryCheckpointStore keeps checkpoints in memory. Checkpoints survive
+// shard retries, but not process restarts.
+type MemoryCheckpointStore struct {
+	mutex sync.Mutex
+	data  map[string]string
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		data: map[string]string{},
+	}
+}
+
+func (m *MemoryCheckpointStore) GetCheckpoint(_ context.Context, streamARN, shardID string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.data[checkpointKey(streamARN, shardID)], nil
+}
+
+func (m *MemoryCheckpointStore) SetCheckpoint(_ context.Context, streamARN, shardID, sequenceNumber string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.data[checkpointKey(streamARN, shardID)] = sequenceNumber
+	return nil
+}
+
+func checkpointKey(streamARN, shardID string) string {
+	return streamARN + "/" + shardID
+}
+
+// checkpoint is the item written by DDBCheckpointStore.
+type checkpoint struct {
+	PK             string
+	SK             string
+	StreamARN      string
+	ShardID        string
+	SequenceNumber string
+}
+
+func (checkpoint) GetType() string {
+	return "Checkpoint"
+}
+
+// DDBCheckpointStore saves checkpoints through a ddb.Store. Each shard has a
+// single item, overwritten by every checkpoint.
+type DDBCheckpointStore struct {
+	store *ddb.Store
+}
+
+func NewDDBCheckpointStore(store *ddb.Store) *DDBCheckpointStore {
+	return &DDBCheckpointStore{
+		store: store,
+	}
+}
+
+// GetCheckpoint reads the checkpoint consistently, so a worker taking over a
+// shard sees the last checkpoint written by its previous owner.
+func (d *DDBCheckpointStore) GetCheckpoint(ctx context.Context, streamARN, shardID string) (string, error) {
+	v, err := d.store.Fetch(ctx, checkpointPK(streamARN), checkpointSK(shardID), ddb.WithConsistentRead())
+	if errors.Is(err, ddb.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read checkpoint for shard, %v: %w", shardID, err)
+	}
+
+	var item checkpoint
+	if err := attributevalue.UnmarshalMap(v, &item); err != nil {
+		return "", fmt.Errorf("unable to unmarshal checkpoint for shard, %v: %w", shardID, err)
+	}
+
+	return item.SequenceNumber, nil
+}
+
+func (d *DDBCheckpointStore) SetCheckpoint(ctx context.Context, streamARN, shardID, sequenceNumber string) error {
+	err := d.store.Save(ctx, checkpoint{
+		PK:             checkpointPK(streamARN),
+		SK:             checkpointSK(shardID),
+		StreamARN:      streamARN,
+		ShardID:        shardID,
+		SequenceNumber: sequenceNumber,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoint for shard, %v: %w", shardID, err)
+	}
+
+	return nil
+}
+
+func checkpointPK(streamARN string) string {
+	return "Checkpoint#" + streamARN
+}
+
+func checkpointSK(shardID string) string {
+	return "Shard#" + shardID
+}
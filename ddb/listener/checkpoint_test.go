@@ -0,0 +1,74 @@
+package listener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func newRecord(sequenceNumber string) *types.Record {
+	return &types.Record{
+		EventID: aws.String("event-" + sequenceNumber),
+		Dynamodb: &types.StreamRecord{
+			SequenceNumber: aws.String(sequenceNumber),
+		},
+	}
+}
+
+func Test_MemoryCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCheckpointStore()
+
+	got, err := store.GetCheckpoint(ctx, "arn", "shard")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got != "" {
+		t.Fatalf("got %v; want empty", got)
+	}
+
+	if err := store.SetCheckpoint(ctx, "arn", "shard", "100"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	got, _ = store.GetCheckpoint(ctx, "arn", "shard")
+	if want := "100"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	got, _ = store.GetCheckpoint(ctx, "other-arn", "shard")
+	if got != "" {
+		t.Fatalf("got %v; want empty", got)
+	}
+}
+
+func Test_checkpoint(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryCheckpointStore()
+	subscriber := &Subscriber{
+		options: buildOptions(WithCheckpointStore(store)),
+	}
+
+	records := []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "B", record: newRecord("2")},
+		{shardID: "A", record: newRecord("3")},
+	}
+	for _, r := range records {
+		subscriber.progress.add(r)
+	}
+	subscriber.checkpoint(ctx, "arn", records)
+
+	testCases := map[string]string{
+		"A": "3",
+		"B": "2",
+	}
+	for shardID, want := range testCases {
+		got, _ := store.GetCheckpoint(ctx, "arn", shardID)
+		if got != want {
+			t.Fatalf("shard %v: got %v; want %v", shardID, got, want)
+		}
+	}
+}
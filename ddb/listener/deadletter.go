@@ -0,0 +1,192 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+)
+
+// DeadLetter holds records of a single shard the subscriber gave up on after
+// exhausting its retries.
+type DeadLetter struct {
+	StreamARN string
+	ShardID   string
+	Records   []*types.Record
+	Err       error
+	Attempts  int
+}
+
+// DeadLetterSink receives the records the subscriber gave up on. Once Send
+// succeeds the records are checkpointed as processed.
+type DeadLetterSink interface {
+	Send(ctx context.Context, letter DeadLetter) error
+}
+
+// ChannelDeadLetterSink publishes dead letters to a channel.
+type ChannelDeadLetterSink struct {
+	ch chan<- DeadLetter
+}
+
+func NewChannelDeadLetterSink(ch chan<- DeadLetter) *ChannelDeadLetterSink {
+	return &ChannelDeadLetterSink{
+		ch: ch,
+	}
+}
+
+func (c *ChannelDeadLetterSink) Send(ctx context.Context, letter DeadLetter) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case c.ch <- letter:
+		return nil
+	}
+}
+
+// FileDeadLetterSink appends dead letters to a JSONL file, one line per dead
+// letter. Records are written in the shape Lambda delivers them so they can be
+// replayed into a handler.
+type FileDeadLetterSink struct {
+	mutex sync.Mutex
+	path  string
+}
+
+func NewFileDeadLetterSink(path string) *FileDeadLetterSink {
+	return &FileDeadLetterSink{
+		path: path,
+	}
+}
+
+type deadLetterLine struct {
+	StreamARN string                       `json:"eventSourceARN"`
+	ShardID   string                       `json:"shardId"`
+	Error     string                       `json:"error"`
+	Attempts  int                          `json:"attempts"`
+	FailedAt  time.Time                    `json:"failedAt"`
+	Records   []events.DynamoDBEventRecord `json:"records"`
+}
+
+func (f *FileDeadLetterSink) Send(_ context.Context, letter DeadLetter) error {
+	line := deadLetterLine{
+		StreamARN: letter.StreamARN,
+		ShardID:   letter.ShardID,
+		Attempts:  letter.Attempts,
+		FailedAt:  time.Now().UTC(),
+	}
+	if letter.Err != nil {
+		line.Error = letter.Err.Error()
+	}
+	for _, record := range letter.Records {
+		line.Records = append(line.Records, ddbstream.ToEventRecord(letter.StreamARN, record))
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("unable to marshal dead letter: %w", err)
+	}
+	data = append(data, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open dead letter file, %v: %w", f.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("unable to write dead letter file, %v: %w", f.path, err)
+	}
+	return file.Close()
+}
+
+// image is a record image stored as a native DynamoDB map.
+type image map[string]ddbTypes.AttributeValue
+
+func (i image) MarshalDynamoDBAttributeValue() (ddbTypes.AttributeValue, error) {
+	return &ddbTypes.AttributeValueMemberM{Value: i}, nil
+}
+
+// deadLetterItem is the item written by DDBDeadLetterSink, one per record.
+type deadLetterItem struct {
+	PK             string
+	SK             string
+	StreamARN      string
+	ShardID        string
+	EventID        string
+	EventName      string
+	SequenceNumber string
+	Error          string
+	Attempts       int
+	Keys           image `dynamodbav:",omitempty"`
+	OldImage       image `dynamodbav:",omitempty"`
+	NewImage       image `dynamodbav:",omitempty"`
+}
+
+func (deadLetterItem) GetType() string {
+	return "DeadLetter"
+}
+
+// DDBDeadLetterSink saves each record of a dead letter as an item of a
+// ddb.Store, along with its keys, images and the error it failed with. Items
+// are keyed by stream, then by shard and sequence number, so the dead letters
+// of a shard are queried together.
+type DDBDeadLetterSink struct {
+	store *ddb.Store
+}
+
+func NewDDBDeadLetterSink(store *ddb.Store) *DDBDeadLetterSink {
+	return &DDBDeadLetterSink{
+		store: store,
+	}
+}
+
+func (d *DDBDeadLetterSink) Send(ctx context.Context, letter DeadLetter) error {
+	var reason string
+	if letter.Err != nil {
+		reason = letter.Err.Error()
+	}
+
+	for _, record := range letter.Records {
+		sequenceNumber := aws.ToString(record.Dynamodb.SequenceNumber)
+		item := deadLetterItem{
+			PK:             "DeadLetter#" + letter.StreamARN,
+			SK:             checkpointSK(letter.ShardID) + "#" + sequenceNumber,
+			StreamARN:      letter.StreamARN,
+			ShardID:        letter.ShardID,
+			EventID:        aws.ToString(record.EventID),
+			EventName:      string(record.EventName),
+			SequenceNumber: sequenceNumber,
+			Error:          reason,
+			Attempts:       letter.Attempts,
+		}
+
+		var err error
+		if item.Keys, err = attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.Keys); err != nil {
+			return fmt.Errorf("unable to convert keys, %v: %w", item.EventID, err)
+		}
+		if item.OldImage, err = attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.OldImage); err != nil {
+			return fmt.Errorf("unable to convert old image, %v: %w", item.EventID, err)
+		}
+		if item.NewImage, err = attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.NewImage); err != nil {
+			return fmt.Errorf("unable to convert new image, %v: %w", item.EventID, err)
+		}
+
+		if err := d.store.Save(ctx, item); err != nil {
+			return fmt.Errorf("unable to save dead letter, %v: %w", item.EventID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func Test_deadLetter(t *testing.T) {
+	ctx := context.Background()
+	ch := make(chan DeadLetter, 2)
+	subscriber := &Subscriber{
+		options: buildOptions(WithDeadLetter(NewChannelDeadLetterSink(ch))),
+	}
+
+	want := errors.New("boom")
+	subscriber.deadLetter(ctx, "arn", []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "B", record: newRecord("2")},
+		{shardID: "A", record: newRecord("3")},
+	}, want, 4)
+
+	a, b := <-ch, <-ch
+	if got, want := a.ShardID, "A"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := len(a.Records), 2; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := b.ShardID, "B"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if !errors.Is(a.Err, want) || a.Attempts != 4 {
+		t.Fatalf("got %v, %v; want %v, 4", a.Err, a.Attempts, want)
+	}
+}
+
+func Test_FileDeadLetterSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	sink := NewFileDeadLetterSink(path)
+
+	record := newRecord("1")
+	record.Dynamodb.NewImage = map[string]types.AttributeValue{
+		"Age": &types.AttributeValueMemberN{Value: "42"},
+	}
+	letter := DeadLetter{StreamARN: "arn", ShardID: "A", Records: []*types.Record{record}, Err: errors.New("boom"), Attempts: 4}
+	for i := 0; i < 2; i++ {
+		if err := sink.Send(context.Background(), letter); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	var lines []deadLetterLine
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var line deadLetterLine
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		lines = append(lines, line)
+	}
+
+	if got, want := len(lines), 2; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := lines[0].Error, "boom"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := lines[0].Records[0].Change.NewImage["Age"].Number(), "42"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_deadLetterItem(t *testing.T) {
+	item := deadLetterItem{
+		PK: "pk",
+		NewImage: image{
+			"Age": &ddbTypes.AttributeValueMemberN{Value: "42"},
+		},
+	}
+
+	got, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	newImage, ok := got["NewImage"].(*ddbTypes.AttributeValueMemberM)
+	if !ok {
+		t.Fatalf("got %T; want *types.AttributeValueMemberM", got["NewImage"])
+	}
+	if age, ok := newImage.Value["Age"].(*ddbTypes.AttributeValueMemberN); !ok || age.Value != "42" {
+		t.Fatalf("got %#v; want 42", newImage.Value["Age"])
+	}
+	if _, ok := got["OldImage"]; ok {
+		t.Fatalf("got OldImage; want omitted")
+	}
+}
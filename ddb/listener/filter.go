@@ -0,0 +1,404 @@
+package listener
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// eventFilter is a compiled event filter pattern, as used by the filter criteria of
+// Lambda event source mappings. Patterns are matched against the record as it
+// would be delivered to Lambda:
+//
+//	{
+//	  "eventName": ["INSERT", "MODIFY"],
+//	  "dynamodb": {
+//	    "Keys": {"PK": {"S": [{"prefix": "User#"}]}},
+//	    "NewImage": {"Type": {"S": ["User"]}}
+//	  }
+//	}
+//
+// Each field of a pattern must match; a field matches if any of its values
+// match. Values are either literals, compared for equality, or one of the
+// filters prefix, anything-but, exists and numeric.
+type eventFilter struct {
+	fields map[string]*eventFilter
+	values []matcher
+}
+
+// matcher reports whether the value of a field matches. ok is false if the
+// field does not exist.
+type matcher func(v interface{}, ok bool) bool
+
+func parseFilter(pattern string) (*eventFilter, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(pattern), &raw); err != nil {
+		return nil, fmt.Errorf("invalid filter pattern, %v: %w", pattern, err)
+	}
+
+	f, err := compileFilter(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter pattern, %v: %w", pattern, err)
+	}
+	return f, nil
+}
+
+func compileFilter(raw map[string]interface{}) (*eventFilter, error) {
+	f := &eventFilter{fields: map[string]*eventFilter{}}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, err := compileFilter(v)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", key, err)
+			}
+			f.fields[key] = child
+
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%v: no values to match", key)
+			}
+
+			child := &eventFilter{}
+			for _, item := range v {
+				m, err := compileMatcher(item)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %w", key, err)
+				}
+				child.values = append(child.values, m)
+			}
+			f.fields[key] = child
+
+		default:
+			return nil, fmt.Errorf("%v: values to match must be in an array", key)
+		}
+	}
+	return f, nil
+}
+
+func compileMatcher(item interface{}) (matcher, error) {
+	rule, ok := item.(map[string]interface{})
+	if !ok {
+		return func(v interface{}, ok bool) bool {
+			return ok && v == item
+		}, nil
+	}
+	if len(rule) != 1 {
+		return nil, fmt.Errorf("filter must have exactly one operator, %v", rule)
+	}
+
+	for op, arg := range rule {
+		switch op {
+		case "prefix":
+			prefix, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("prefix must be a string, %v", arg)
+			}
+			return func(v interface{}, ok bool) bool {
+				s, isString := v.(string)
+				return ok && isString && strings.HasPrefix(s, prefix)
+			}, nil
+
+		case "anything-but":
+			excluded, err := compileAnythingBut(arg)
+			if err != nil {
+				return nil, err
+			}
+			return func(v interface{}, ok bool) bool {
+				return ok && !excluded(v, ok)
+			}, nil
+
+		case "exists":
+			exists, ok := arg.(bool)
+			if !ok {
+				return nil, fmt.Errorf("exists must be a boolean, %v", arg)
+			}
+			return func(_ interface{}, ok bool) bool {
+				return ok == exists
+			}, nil
+
+		case "numeric":
+			return compileNumeric(arg)
+
+		default:
+			return nil, fmt.Errorf("unsupported filter, %v", op)
+		}
+	}
+	panic("unreachable")
+}
+
+func compileAnythingBut(arg interface{}) (matcher, error) {
+	switch v := arg.(type) {
+	case []interface{}:
+		return func(value interface{}, _ bool) bool {
+			for _, item := range v {
+				if value == item {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case map[string]interface{}:
+		if _, ok := v["prefix"]; !ok || len(v) != 1 {
+			return nil, fmt.Errorf("anything-but only supports prefix, %v", v)
+		}
+		return compileMatcher(v)
+
+	default:
+		return func(value interface{}, _ bool) bool {
+			return value == v
+		}, nil
+	}
+}
+
+func compileNumeric(arg interface{}) (matcher, error) {
+	args, ok := arg.([]interface{})
+	if !ok || len(args) == 0 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("numeric must be pairs of operator and number, %v", arg)
+	}
+
+	var conditions []func(float64) bool
+	for i := 0; i < len(args); i += 2 {
+		op, _ := args[i].(string)
+		n, ok := args[i+1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("numeric must compare to a number, %v", args[i+1])
+		}
+
+		switch op {
+		case "=":
+			conditions = append(conditions, func(v float64) bool { return v == n })
+		case "<":
+			conditions = append(conditions, func(v float64) bool { return v < n })
+		case "<=":
+			conditions = append(conditions, func(v float64) bool { return v <= n })
+		case ">":
+			conditions = append(conditions, func(v float64) bool { return v > n })
+		case ">=":
+			conditions = append(conditions, func(v float64) bool { return v >= n })
+		default:
+			return nil, fmt.Errorf("unsupported numeric operator, %v", args[i])
+		}
+	}
+
+	return func(v interface{}, ok bool) bool {
+		if !ok {
+			return false
+		}
+
+		// numbers in attribute values are strings, {"N": "42"}
+		var n float64
+		switch value := v.(type) {
+		case float64:
+			n = value
+		case string:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return false
+			}
+			n = f
+		default:
+			return false
+		}
+
+		for _, condition := range conditions {
+			if !condition(n) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// fields looks up the fields of an object of the record as it would be
+// delivered to Lambda. ok is false if the field does not exist. Nested
+// objects are fields themselves, so a record is only read as far as the
+// filter goes.
+type fields func(key string) (v interface{}, ok bool)
+
+func (f *eventFilter) match(get fields) bool {
+	for key, child := range f.fields {
+		var (
+			value interface{}
+			ok    bool
+		)
+		if get != nil {
+			value, ok = get(key)
+		}
+
+		if child.values == nil {
+			nested, _ := value.(fields)
+			if !child.match(nested) {
+				return false
+			}
+			continue
+		}
+
+		if !child.matchValue(value, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *eventFilter) matchValue(value interface{}, ok bool) bool {
+	if values, isArray := value.([]interface{}); isArray && len(values) > 0 {
+		for _, v := range values {
+			if f.matchValue(v, true) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, m := range f.values {
+		if m(value, ok) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordFields returns the fields of record, named as in the Lambda event.
+func recordFields(streamARN string, record *types.Record) fields {
+	return func(key string) (interface{}, bool) {
+		switch key {
+		case "awsRegion":
+			return aws.ToString(record.AwsRegion), true
+		case "eventID":
+			return aws.ToString(record.EventID), true
+		case "eventName":
+			return string(record.EventName), true
+		case "eventSource":
+			return aws.ToString(record.EventSource), true
+		case "eventSourceARN":
+			return streamARN, true
+		case "eventVersion":
+			return aws.ToString(record.EventVersion), true
+		case "dynamodb":
+			change := record.Dynamodb
+			if change == nil {
+				change = &types.StreamRecord{}
+			}
+			return changeFields(change), true
+		}
+		return nil, false
+	}
+}
+
+func changeFields(change *types.StreamRecord) fields {
+	return func(key string) (interface{}, bool) {
+		switch key {
+		case "ApproximateCreationDateTime":
+			return float64(aws.ToTime(change.ApproximateCreationDateTime).Unix()), true
+		case "Keys":
+			return imageFields(change.Keys)
+		case "NewImage":
+			return imageFields(change.NewImage)
+		case "OldImage":
+			return imageFields(change.OldImage)
+		case "SequenceNumber":
+			return aws.ToString(change.SequenceNumber), true
+		case "SizeBytes":
+			return float64(aws.ToInt64(change.SizeBytes)), true
+		case "StreamViewType":
+			return string(change.StreamViewType), true
+		}
+		return nil, false
+	}
+}
+
+// imageFields returns the fields of the keys or an image. Like the Lambda
+// event, an empty image has no fields.
+func imageFields(image map[string]types.AttributeValue) (fields, bool) {
+	if len(image) == 0 {
+		return nil, false
+	}
+	return attributeFields(image), true
+}
+
+func attributeFields(m map[string]types.AttributeValue) fields {
+	return func(key string) (interface{}, bool) {
+		av, ok := m[key]
+		if !ok {
+			return nil, false
+		}
+		return attributeValueFields(av), true
+	}
+}
+
+// attributeValueFields returns the fields of an attribute value, keyed by its
+// type as in {"S": "User"}. Numbers are strings and binary values are base64,
+// as they are in JSON.
+func attributeValueFields(av types.AttributeValue) fields {
+	var typ string
+	var value interface{}
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		typ, value = "S", v.Value
+	case *types.AttributeValueMemberN:
+		typ, value = "N", v.Value
+	case *types.AttributeValueMemberB:
+		typ, value = "B", base64.StdEncoding.EncodeToString(v.Value)
+	case *types.AttributeValueMemberBOOL:
+		typ, value = "BOOL", v.Value
+	case *types.AttributeValueMemberSS:
+		typ, value = "SS", stringValues(v.Value)
+	case *types.AttributeValueMemberNS:
+		typ, value = "NS", stringValues(v.Value)
+	case *types.AttributeValueMemberBS:
+		values := make([]interface{}, 0, len(v.Value))
+		for _, b := range v.Value {
+			values = append(values, base64.StdEncoding.EncodeToString(b))
+		}
+		typ, value = "BS", values
+	case *types.AttributeValueMemberL:
+		values := make([]interface{}, 0, len(v.Value))
+		for _, item := range v.Value {
+			values = append(values, attributeValueFields(item))
+		}
+		typ, value = "L", values
+	case *types.AttributeValueMemberM:
+		typ, value = "M", attributeFields(v.Value)
+	default:
+		typ, value = "NULL", true
+	}
+
+	return func(key string) (interface{}, bool) {
+		if key != typ {
+			return nil, false
+		}
+		return value, true
+	}
+}
+
+func stringValues(ss []string) []interface{} {
+	values := make([]interface{}, 0, len(ss))
+	for _, s := range ss {
+		values = append(values, s)
+	}
+	return values
+}
+
+// eventFilters accept a record if it matches any of them, or if there are none.
+type eventFilters []*eventFilter
+
+func (ff eventFilters) accept(streamARN string, record *types.Record) bool {
+	if len(ff) == 0 {
+		return true
+	}
+
+	event := recordFields(streamARN, record)
+	for _, f := range ff {
+		if f.match(event) {
+			return true
+		}
+	}
+	return false
+}
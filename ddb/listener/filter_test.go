@@ -0,0 +1,139 @@
+package listener
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func Test_eventFilters_accept(t *testing.T) {
+	insert := newRecord("1")
+	insert.EventName = types.OperationTypeInsert
+	insert.Dynamodb.Keys = map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: "User#1"},
+		"SK": &types.AttributeValueMemberS{Value: "Profile"},
+	}
+	insert.Dynamodb.NewImage = map[string]types.AttributeValue{
+		"Type":   &types.AttributeValueMemberS{Value: "User"},
+		"Logins": &types.AttributeValueMemberN{Value: "42"},
+	}
+
+	testCases := map[string]struct {
+		Patterns []string
+		Want     bool
+	}{
+		"no filters": {
+			Want: true,
+		},
+		"event name": {
+			Patterns: []string{`{"eventName": ["INSERT", "MODIFY"]}`},
+			Want:     true,
+		},
+		"other event name": {
+			Patterns: []string{`{"eventName": ["REMOVE"]}`},
+		},
+		"key prefix": {
+			Patterns: []string{`{"dynamodb": {"Keys": {"PK": {"S": [{"prefix": "User#"}]}}}}`},
+			Want:     true,
+		},
+		"other key prefix": {
+			Patterns: []string{`{"dynamodb": {"Keys": {"PK": {"S": [{"prefix": "Org#"}]}}}}`},
+		},
+		"type": {
+			Patterns: []string{`{"eventName": ["INSERT"], "dynamodb": {"NewImage": {"Type": {"S": ["User"]}}}}`},
+			Want:     true,
+		},
+		"old image type": {
+			Patterns: []string{`{"dynamodb": {"OldImage": {"Type": {"S": ["User"]}}}}`},
+		},
+		"anything but": {
+			Patterns: []string{`{"dynamodb": {"NewImage": {"Type": {"S": [{"anything-but": ["Org"]}]}}}}`},
+			Want:     true,
+		},
+		"exists": {
+			Patterns: []string{`{"dynamodb": {"OldImage": {"Type": [{"exists": false}]}}}`},
+			Want:     true,
+		},
+		"numeric": {
+			Patterns: []string{`{"dynamodb": {"NewImage": {"Logins": {"N": [{"numeric": [">", 10, "<=", 42]}]}}}}`},
+			Want:     true,
+		},
+		"any pattern": {
+			Patterns: []string{`{"eventName": ["REMOVE"]}`, `{"eventName": ["INSERT"]}`},
+			Want:     true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			options := buildOptions(WithFilter(tc.Patterns...))
+			if err := options.validate(); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			if got := options.filters.accept("arn", insert); got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func Test_parseFilter(t *testing.T) {
+	testCases := map[string]string{
+		"not json":         `{`,
+		"not an array":     `{"eventName": "INSERT"}`,
+		"empty array":      `{"eventName": []}`,
+		"unknown filter":   `{"eventName": [{"suffix": "T"}]}`,
+		"numeric operator": `{"dynamodb": {"SizeBytes": [{"numeric": ["!", 1]}]}}`,
+	}
+
+	for label, pattern := range testCases {
+		t.Run(label, func(t *testing.T) {
+			if _, err := parseFilter(pattern); err == nil {
+				t.Fatalf("got nil; want error")
+			}
+		})
+	}
+}
+
+func Test_eventFilters_accept_attributeValues(t *testing.T) {
+	record := newRecord("1")
+	record.Dynamodb.NewImage = map[string]types.AttributeValue{
+		"B":    &types.AttributeValueMemberB{Value: []byte("hi")},
+		"BOOL": &types.AttributeValueMemberBOOL{Value: true},
+		"NULL": &types.AttributeValueMemberNULL{Value: true},
+		"SS":   &types.AttributeValueMemberSS{Value: []string{"a", "b"}},
+		"NS":   &types.AttributeValueMemberNS{Value: []string{"1", "2"}},
+		"L":    &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "x"}}},
+		"M":    &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"S": &types.AttributeValueMemberS{Value: "y"}}},
+	}
+
+	testCases := map[string]struct {
+		Pattern string
+		Want    bool
+	}{
+		"binary":          {Pattern: `{"dynamodb": {"NewImage": {"B": {"B": ["aGk="]}}}}`, Want: true},
+		"boolean":         {Pattern: `{"dynamodb": {"NewImage": {"BOOL": {"BOOL": [true]}}}}`, Want: true},
+		"null":            {Pattern: `{"dynamodb": {"NewImage": {"NULL": {"NULL": [true]}}}}`, Want: true},
+		"string set":      {Pattern: `{"dynamodb": {"NewImage": {"SS": {"SS": ["b"]}}}}`, Want: true},
+		"number set":      {Pattern: `{"dynamodb": {"NewImage": {"NS": {"NS": [{"numeric": [">", 1]}]}}}}`, Want: true},
+		"map":             {Pattern: `{"dynamodb": {"NewImage": {"M": {"M": {"S": {"S": ["y"]}}}}}}`, Want: true},
+		"other type":      {Pattern: `{"dynamodb": {"NewImage": {"B": {"S": [{"exists": true}]}}}}`},
+		"sequence number": {Pattern: `{"dynamodb": {"SequenceNumber": ["1"]}}`, Want: true},
+		"stream arn":      {Pattern: `{"eventSourceARN": ["arn"]}`, Want: true},
+		"unknown field":   {Pattern: `{"dynamodb": {"Unknown": [{"exists": false}]}}`, Want: true},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			f, err := parseFilter(tc.Pattern)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+
+			if got := (eventFilters{f}).accept("arn", record); got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
@@ -6,52 +6,80 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
 )
 
 type lambdaHandler interface {
 	Invoke(context.Context, []byte) ([]byte, error)
 }
 
-type handlerFunc func(ctx context.Context, data []byte) error
+// handlerFunc handles a Lambda-shaped event. Handlers may report partial
+// batch failures in the response, as with Lambda's ReportBatchItemFailures.
+type handlerFunc func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error)
 
-func (fn handlerFunc) Handle(ctx context.Context, data []byte) error {
-	return fn(ctx, data)
-}
-
-type invokeFunc func(ctx context.Context, records []*types.Record) error
+// invokeFunc delivers a batch of records. An error fails the whole batch while
+// the response identifies individual records, by sequence number, that failed.
+type invokeFunc func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error)
 
 func newInvoker(streamARN string, raw interface{}) invokeFunc {
 	var handler handlerFunc
 	switch fn := raw.(type) {
+	case *Router:
+		return fn.invoker(streamARN)
+
+	case ddbstream.Processor:
+		return func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			md, _ := ddbstream.FromContext(ctx)
+			md.StreamARN = streamARN
+			return fn.Process(ctx, ddbstream.Batch{Metadata: md, Records: records})
+		}
+
 	case lambdaHandler:
-		handler = func(ctx context.Context, data []byte) error {
-			_, err := fn.Invoke(ctx, data)
-			return err
+		handler = func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+			var response events.DynamoDBEventResponse
+			out, err := fn.Invoke(ctx, data)
+			if err != nil {
+				return response, err
+			}
+			// handlers that return anything other than a batch response succeeded
+			_ = json.Unmarshal(out, &response)
+			return response, nil
 		}
 
 	case func(ctx context.Context, data json.RawMessage) error:
-		handler = func(ctx context.Context, data []byte) error {
+		handler = func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{}, fn(ctx, data)
+		}
+
+	case func(ctx context.Context, data json.RawMessage) (events.DynamoDBEventResponse, error):
+		handler = func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
 			return fn(ctx, data)
 		}
 
 	case func(ctx context.Context, records []*types.Record) error:
+		return func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{}, fn(ctx, records)
+		}
+
+	case func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error):
 		return fn
 
 	default:
 		handler = newHandler(fn)
 	}
 
-	return func(ctx context.Context, records []*types.Record) error {
+	return func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
 		event := map[string]interface{}{
 			"Records": wrap(streamARN, records),
 		}
 		data, err := json.Marshal(event)
 		if err != nil {
-			return fmt.Errorf("unable to marshal event: %w", err)
+			return events.DynamoDBEventResponse{}, fmt.Errorf("unable to marshal event: %w", err)
 		}
 
-		return handler.Handle(ctx, data)
+		return handler(ctx, data)
 	}
 }
 
@@ -75,42 +103,46 @@ func newHandler(v interface{}) handlerFunc {
 	typ := reflect.TypeOf(v)
 	val := reflect.ValueOf(v)
 	if typ.Kind() != reflect.Func {
-		return func(ctx context.Context, data []byte) error {
-			return fmt.Errorf("invalid handler type, %T: expected func", v)
+		return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{}, fmt.Errorf("invalid handler type, %T: expected func", v)
 		}
 	}
 	if v := typ.NumIn(); v > 2 {
-		return func(ctx context.Context, data []byte) error {
-			return fmt.Errorf("handler func accepts at most 2 arguments: got %v", v)
+		return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{}, fmt.Errorf("handler func accepts at most 2 arguments: got %v", v)
 		}
 	}
 	switch {
 	case typ.NumIn() == 1:
 		if arg1 := typ.In(0); !isStruct(arg1) {
-			return func(ctx context.Context, data []byte) error {
-				return fmt.Errorf("argument must be a struct type; got %T", v)
+			return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+				return events.DynamoDBEventResponse{}, fmt.Errorf("argument must be a struct type; got %T", v)
 			}
 		}
 
 	case typ.NumIn() == 2:
 		if arg1, arg2 := typ.In(0), typ.In(1); !isContext(arg1) || !isStruct(arg2) {
-			return func(ctx context.Context, data []byte) error {
-				return fmt.Errorf("want func(context.Context, {struct}); got func(%v, %v)", arg1, arg2)
+			return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+				return events.DynamoDBEventResponse{}, fmt.Errorf("want func(context.Context, {struct}); got func(%v, %v)", arg1, arg2)
 			}
 		}
 	}
 
-	if typ.NumOut() != 1 {
-		return func(ctx context.Context, data []byte) error {
-			return fmt.Errorf("handler func expects exactly 1 return value, error; got %v", v)
+	switch {
+	case typ.NumOut() == 1 && typ.Out(0) == errorType:
+	case typ.NumOut() == 2 && typ.Out(0) == responseType && typ.Out(1) == errorType:
+	default:
+		return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{}, fmt.Errorf("handler func expects exactly 1 return value, error, or 2 return values, (events.DynamoDBEventResponse, error); got %T", v)
 		}
 	}
 
 	param := typ.In(typ.NumIn() - 1)
-	return func(ctx context.Context, data []byte) error {
+	return func(ctx context.Context, data []byte) (events.DynamoDBEventResponse, error) {
+		var response events.DynamoDBEventResponse
 		v := reflect.New(param).Interface()
 		if err := json.Unmarshal(data, v); err != nil {
-			return fmt.Errorf("unable to unmarshal param, %v: %w", param.String(), err)
+			return response, fmt.Errorf("unable to unmarshal param, %v: %w", param.String(), err)
 		}
 
 		paramValue := reflect.ValueOf(v)
@@ -131,14 +163,21 @@ func newHandler(v interface{}) handlerFunc {
 		}
 
 		got := val.Call(args)
-		if got[0].IsNil() {
-			return nil
+		if len(got) == 2 {
+			response = got[0].Interface().(events.DynamoDBEventResponse)
+		}
+		if errValue := got[len(got)-1]; !errValue.IsNil() {
+			return response, errValue.Interface().(error)
 		}
-		return got[0].Interface().(error)
+		return response, nil
 	}
 }
 
-var contextType = reflect.TypeOf(new(context.Context)).Elem()
+var (
+	contextType  = reflect.TypeOf(new(context.Context)).Elem()
+	errorType    = reflect.TypeOf(new(error)).Elem()
+	responseType = reflect.TypeOf(events.DynamoDBEventResponse{})
+)
 
 func isContext(arg reflect.Type) bool {
 	return arg.Implements(contextType)
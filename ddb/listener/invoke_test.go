@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
 )
 
 func Test_newHandler(t *testing.T) {
@@ -22,7 +26,7 @@ func Test_newHandler(t *testing.T) {
 		}
 
 		handler := newHandler(fn)
-		err := handler.Handle(context.Background(), []byte(`{"Records":[{}]}`))
+		_, err := handler(context.Background(), []byte(`{"Records":[{}]}`))
 		if err != nil {
 			t.Fatalf("got %v; want nil", err)
 		}
@@ -39,7 +43,7 @@ func Test_newHandler(t *testing.T) {
 		}
 
 		handler := newHandler(fn)
-		err := handler.Handle(context.Background(), []byte(`{"Records":[{}]}`))
+		_, err := handler(context.Background(), []byte(`{"Records":[{}]}`))
 		if err != nil {
 			t.Fatalf("got %v; want nil", err)
 		}
@@ -55,7 +59,7 @@ func Test_newHandler(t *testing.T) {
 		}
 
 		handler := newHandler(fn)
-		got := handler.Handle(context.Background(), []byte(`{"Records":[{}]}`))
+		_, got := handler(context.Background(), []byte(`{"Records":[{}]}`))
 		if !errors.Is(got, want) {
 			t.Fatalf("got %v; want %v", got, want)
 		}
@@ -91,7 +95,7 @@ func Test_newHandler(t *testing.T) {
 		for label, tc := range testCases {
 			t.Run(label, func(t *testing.T) {
 				handler := newHandler(tc.Input)
-				err := handler.Handle(ctx, []byte(`{}`))
+				_, err := handler(ctx, []byte(`{}`))
 				if err == nil {
 					t.Fatalf("got nil; want not nil")
 				}
@@ -116,7 +120,7 @@ func Test_newInvoker(t *testing.T) {
 	t.Run("lambda.Handler", func(t *testing.T) {
 		handler := &TestHandler{}
 		fn := newInvoker("blah", handler)
-		err := fn(context.Background(), nil)
+		_, err := fn(context.Background(), nil)
 		if err != nil {
 			t.Fatalf("got %v; want nil", err)
 		}
@@ -132,7 +136,7 @@ func Test_newInvoker(t *testing.T) {
 			return nil
 		}
 		fn := newInvoker("blah", raw)
-		err := fn(context.Background(), nil)
+		_, err := fn(context.Background(), nil)
 		if err != nil {
 			t.Fatalf("got %v; want nil", err)
 		}
@@ -141,3 +145,38 @@ func Test_newInvoker(t *testing.T) {
 		}
 	})
 }
+
+type FailingHandler struct{}
+
+func (FailingHandler) Invoke(context.Context, []byte) ([]byte, error) {
+	return []byte(`{"batchItemFailures":[{"itemIdentifier":"2"}]}`), nil
+}
+
+func Test_newInvoker_batchItemFailures(t *testing.T) {
+	want := events.DynamoDBEventResponse{
+		BatchItemFailures: []events.DynamoDBBatchItemFailure{{ItemIdentifier: "2"}},
+	}
+
+	testCases := map[string]interface{}{
+		"lambda.Handler": FailingHandler{},
+		"records": func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			return want, nil
+		},
+		"via reflection": func(ctx context.Context, event struct{ Records []json.RawMessage }) (events.DynamoDBEventResponse, error) {
+			return want, nil
+		},
+	}
+
+	for label, raw := range testCases {
+		t.Run(label, func(t *testing.T) {
+			fn := newInvoker("blah", raw)
+			got, err := fn(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v; want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,508 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const defaultLeaseDuration = 30 * time.Second
+
+// completedLeaseRetention is how long completed leases are kept, so every
+// worker learns a shard was completed before its children are leased. It
+// matches the 24 hour retention of the stream, after which the shard is
+// trimmed and no worker lists it again.
+const completedLeaseRetention = 24 * time.Hour
+
+// ErrLeaseConflict is returned by a LeaseStore when a lease was modified by
+// another worker since it was last read.
+var ErrLeaseConflict = errors.New("lease was modified by another worker")
+
+// Lease grants a worker exclusive ownership of a shard until ExpiresAt.
+type Lease struct {
+	ShardID string
+	Owner   string
+	// Counter is incremented on every write and guards conditional updates.
+	Counter   int64
+	ExpiresAt time.Time
+	// Completed is set once the shard has been read to the end. Completed
+	// leases are deleted once ExpiresAt has passed.
+	Completed bool
+}
+
+// expired compares ExpiresAt with now, so it's only meaningful for leases
+// written by this worker.
+func (l Lease) expired(now time.Time) bool {
+	return l.Owner == "" || !now.Before(l.ExpiresAt)
+}
+
+// observation records when a lease was first seen with its counter, by the
+// local clock.
+type observation struct {
+	counter int64
+	at      time.Time
+}
+
+// LeaseStore persists shard leases shared by all workers of a stream.
+type LeaseStore interface {
+	// ListLeases returns every lease recorded for the stream.
+	ListLeases(ctx context.Context, streamARN string) ([]Lease, error)
+
+	// PutLease writes lease, provided the stored lease still has the given
+	// counter. A counter of 0 requires that no lease exists for the shard.
+	// Returns ErrLeaseConflict when the condition is not met.
+	PutLease(ctx context.Context, streamARN string, lease Lease, counter int64) error
+
+	// DeleteLease deletes the lease for the shard, provided the stored lease
+	// still has the given counter. Returns ErrLeaseConflict when the condition
+	// is not met.
+	DeleteLease(ctx context.Context, streamARN string, shardID string, counter int64) error
+}
+
+// LeaseManager assigns shards to workers so that several processes can
+// subscribe to the same stream while each shard is read by a single worker.
+// Leases that are not renewed within the lease duration expire and are taken
+// over by other workers. As in the KCL, a worker judges expiry by its own
+// clock, from how long a lease has gone without being renewed, so workers
+// don't need their clocks to agree. When workers join or leave, leases are stolen from
+// the busiest worker until each holds its fair share.
+//
+// Workers sharing leases should also share a durable CheckpointStore so that
+// a shard resumes where its previous owner left off.
+type LeaseManager struct {
+	store    LeaseStore
+	workerID string
+	duration time.Duration
+	now      func() time.Time
+	observed map[string]observation // only used by sync
+
+	mutex   sync.Mutex
+	written *sync.Cond // broadcast when a shard is no longer busy
+	held    map[string]Lease
+	busy    map[string]bool // shards whose lease is being renewed
+}
+
+// NewLeaseManager returns a LeaseManager acting on behalf of workerID, which
+// must be unique among the workers sharing the store.
+func NewLeaseManager(store LeaseStore, workerID string, duration time.Duration) *LeaseManager {
+	if duration <= 0 {
+		duration = defaultLeaseDuration
+	}
+
+	m := &LeaseManager{
+		store:    store,
+		workerID: workerID,
+		duration: duration,
+		now:      time.Now,
+		observed: map[string]observation{},
+		held:     map[string]Lease{},
+		busy:     map[string]bool{},
+	}
+	m.written = sync.NewCond(&m.mutex)
+	return m
+}
+
+// sync takes, renews and steals leases for the shards available to be read and
+// returns the shards owned by this worker along with any shards other workers
+// have completed. Completed leases past their retention are deleted.
+func (m *LeaseManager) sync(ctx context.Context, streamARN string, shardIDs []string) (owned, completed []string, err error) {
+	leases, err := m.store.ListLeases(ctx, streamARN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list leases: %w", err)
+	}
+
+	now := m.now()
+	byShard := map[string]Lease{}
+	for _, lease := range leases {
+		byShard[lease.ShardID] = lease
+		if lease.Completed {
+			completed = append(completed, lease.ShardID)
+			// skew between clocks is negligible against the retention;
+			// failures are retried on the next sync
+			if !now.Before(lease.ExpiresAt) {
+				m.store.DeleteLease(ctx, streamARN, lease.ShardID, lease.Counter)
+			}
+		}
+	}
+
+	var (
+		available []Lease
+		counts    = map[string]int{m.workerID: 0}
+		active    = 0
+	)
+	for _, shardID := range shardIDs {
+		lease, ok := byShard[shardID]
+		switch {
+		case !ok:
+			available = append(available, Lease{ShardID: shardID})
+			active++
+		case lease.Completed:
+			// nothing to do
+		case m.expired(lease, now):
+			available = append(available, lease)
+			active++
+		default:
+			counts[lease.Owner]++
+			active++
+		}
+	}
+
+	for shardID := range m.observed {
+		if _, ok := byShard[shardID]; !ok {
+			delete(m.observed, shardID)
+		}
+	}
+
+	// forget leases that were lost to another worker
+	m.mutex.Lock()
+	for shardID := range m.held {
+		if lease, ok := byShard[shardID]; !ok || lease.Owner != m.workerID || lease.expired(now) {
+			delete(m.held, shardID)
+		}
+	}
+	m.mutex.Unlock()
+
+	target := (active + len(counts) - 1) / len(counts)
+
+	for _, lease := range available {
+		if counts[m.workerID] >= target {
+			break
+		}
+		if m.take(ctx, streamARN, lease) {
+			counts[m.workerID]++
+		}
+	}
+
+	if counts[m.workerID] < target {
+		if victim := busiest(counts, m.workerID); victim != "" && counts[victim] > target {
+			for _, shardID := range shardIDs {
+				if lease, ok := byShard[shardID]; ok && lease.Owner == victim && !lease.Completed && !m.expired(lease, now) {
+					if m.take(ctx, streamARN, lease) {
+						counts[m.workerID]++
+					}
+					break
+				}
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	for shardID := range m.held {
+		owned = append(owned, shardID)
+	}
+	m.mutex.Unlock()
+	sort.Strings(owned)
+
+	return owned, completed, nil
+}
+
+// expired reports whether the lease may be taken over. A lease is expired
+// once its counter has been unchanged for the lease duration since this worker
+// first saw it, rather than by its ExpiresAt, which was set by another
+// worker's clock.
+func (m *LeaseManager) expired(lease Lease, now time.Time) bool {
+	if lease.Owner == "" {
+		return true
+	}
+
+	seen, ok := m.observed[lease.ShardID]
+	if !ok || seen.counter != lease.Counter {
+		seen = observation{counter: lease.Counter, at: now}
+		m.observed[lease.ShardID] = seen
+	}
+	return now.Sub(seen.at) >= m.duration
+}
+
+// take claims the lease for this worker.
+func (m *LeaseManager) take(ctx context.Context, streamARN string, lease Lease) bool {
+	next := Lease{
+		ShardID:   lease.ShardID,
+		Owner:     m.workerID,
+		Counter:   lease.Counter + 1,
+		ExpiresAt: m.now().Add(m.duration),
+	}
+	if err := m.store.PutLease(ctx, streamARN, next, lease.Counter); err != nil {
+		return false
+	}
+
+	m.mutex.Lock()
+	m.held[lease.ShardID] = next
+	m.mutex.Unlock()
+	return true
+}
+
+// renew extends every lease held by this worker and returns the shards whose
+// leases have been lost.
+func (m *LeaseManager) renew(ctx context.Context, streamARN string) (lost []string, err error) {
+	m.mutex.Lock()
+	shardIDs := make([]string, 0, len(m.held))
+	for shardID := range m.held {
+		shardIDs = append(shardIDs, shardID)
+	}
+	m.mutex.Unlock()
+
+	for _, shardID := range shardIDs {
+		// the lease is busy while it's renewed, so it isn't given up with the
+		// counter the renewal is about to replace
+		m.mutex.Lock()
+		lease, ok := m.held[shardID]
+		if ok {
+			m.busy[shardID] = true
+		}
+		m.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		next := lease
+		next.Counter++
+		next.ExpiresAt = m.now().Add(m.duration)
+
+		err := m.store.PutLease(ctx, streamARN, next, lease.Counter)
+
+		m.mutex.Lock()
+		delete(m.busy, shardID)
+		switch {
+		case errors.Is(err, ErrLeaseConflict):
+			delete(m.held, shardID)
+			lost = append(lost, shardID)
+		case err == nil:
+			if _, ok := m.held[shardID]; ok {
+				m.held[shardID] = next
+			}
+		}
+		m.mutex.Unlock()
+		m.written.Broadcast()
+
+		if err != nil && !errors.Is(err, ErrLeaseConflict) {
+			return lost, fmt.Errorf("unable to renew lease for shard, %v: %w", shardID, err)
+		}
+	}
+
+	return lost, nil
+}
+
+// complete marks the shard as read to the end so that its children may be
+// leased.
+func (m *LeaseManager) complete(ctx context.Context, streamARN string, shardID string) error {
+	return m.giveUp(ctx, streamARN, shardID, true)
+}
+
+// release gives up the lease for the shard so another worker may take it
+// without waiting for it to expire.
+func (m *LeaseManager) release(ctx context.Context, streamARN string, shardID string) error {
+	return m.giveUp(ctx, streamARN, shardID, false)
+}
+
+// releaseAll gives up every lease held by this worker.
+func (m *LeaseManager) releaseAll(ctx context.Context, streamARN string) error {
+	m.mutex.Lock()
+	var shardIDs []string
+	for shardID := range m.held {
+		shardIDs = append(shardIDs, shardID)
+	}
+	m.mutex.Unlock()
+
+	var errs []error
+	for _, shardID := range shardIDs {
+		if err := m.release(ctx, streamARN, shardID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *LeaseManager) giveUp(ctx context.Context, streamARN string, shardID string, completed bool) error {
+	m.mutex.Lock()
+	for m.busy[shardID] {
+		m.written.Wait()
+	}
+	lease, ok := m.held[shardID]
+	delete(m.held, shardID)
+	m.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	next := Lease{
+		ShardID:   shardID,
+		Counter:   lease.Counter + 1,
+		Completed: completed,
+	}
+	if completed {
+		next.ExpiresAt = m.now().Add(completedLeaseRetention)
+	}
+	if err := m.store.PutLease(ctx, streamARN, next, lease.Counter); err != nil {
+		return fmt.Errorf("unable to release lease for shard, %v: %w", shardID, err)
+	}
+	return nil
+}
+
+// busiest returns the worker, other than self, holding the most leases.
+func busiest(counts map[string]int, self string) string {
+	var (
+		worker string
+		most   int
+	)
+	for owner, n := range counts {
+		if owner == self {
+			continue
+		}
+		if n > most || (n == most && owner < worker) {
+			worker, most = owner, n
+		}
+	}
+	return worker
+}
+
+// leaseItem is the item written by DDBLeaseStore.
+type leaseItem struct {
+	PK        string
+	SK        string
+	ShardID   string
+	Owner     string
+	Counter   int64
+	ExpiresAt string
+	Completed bool
+}
+
+// DDBLeaseStore keeps the leases of a stream in a DynamoDB table, in a single
+// partition so they're listed with one query. It writes with the client
+// rather than a ddb.Store, so each put and delete is conditional on the lease
+// counter.
+type DDBLeaseStore struct {
+	client    *dynamodb.Client
+	tableName *string
+}
+
+func NewDDBLeaseStore(client *dynamodb.Client, tableName *string) *DDBLeaseStore {
+	return &DDBLeaseStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+func (d *DDBLeaseStore) ListLeases(ctx context.Context, streamARN string) ([]Lease, error) {
+	paginator := dynamodb.NewQueryPaginator(d.client, &dynamodb.QueryInput{
+		TableName:              d.tableName,
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: leasePK(streamARN)},
+		},
+	})
+
+	var leases []Lease
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ddb.Query: %w", err)
+		}
+
+		for _, item := range out.Items {
+			var v leaseItem
+			if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+				return nil, fmt.Errorf("av.UnmarshalMap: %w", err)
+			}
+
+			expiresAt, err := time.Parse(time.RFC3339Nano, v.ExpiresAt)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse lease expiry for shard, %v: %w", v.ShardID, err)
+			}
+			leases = append(leases, Lease{
+				ShardID:   v.ShardID,
+				Owner:     v.Owner,
+				Counter:   v.Counter,
+				ExpiresAt: expiresAt,
+				Completed: v.Completed,
+			})
+		}
+	}
+
+	return leases, nil
+}
+
+func (d *DDBLeaseStore) PutLease(ctx context.Context, streamARN string, l Lease, counter int64) error {
+	item := map[string]ddbTypes.AttributeValue{
+		"PK":        &ddbTypes.AttributeValueMemberS{Value: leasePK(streamARN)},
+		"SK":        &ddbTypes.AttributeValueMemberS{Value: leaseSK(l.ShardID)},
+		"ShardID":   &ddbTypes.AttributeValueMemberS{Value: l.ShardID},
+		"Owner":     &ddbTypes.AttributeValueMemberS{Value: l.Owner},
+		"Counter":   &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(l.Counter, 10)},
+		"ExpiresAt": &ddbTypes.AttributeValueMemberS{Value: l.ExpiresAt.UTC().Format(time.RFC3339Nano)},
+		"Completed": &ddbTypes.AttributeValueMemberBOOL{Value: l.Completed},
+		"Type":      &ddbTypes.AttributeValueMemberS{Value: "Lease"},
+		"UpdatedAt": &ddbTypes.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339Nano)},
+	}
+
+	input := dynamodb.PutItemInput{
+		TableName: d.tableName,
+		Item:      item,
+	}
+	if counter == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(PK)")
+	} else {
+		input.ConditionExpression = aws.String("#counter = :counter")
+		input.ExpressionAttributeNames = map[string]string{
+			"#counter": "Counter",
+		}
+		input.ExpressionAttributeValues = map[string]ddbTypes.AttributeValue{
+			":counter": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(counter, 10)},
+		}
+	}
+
+	_, err := d.client.PutItem(ctx, &input)
+	if err != nil {
+		var ccf *ddbTypes.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrLeaseConflict
+		}
+		return fmt.Errorf("ddb.PutItem: %w", err)
+	}
+
+	return nil
+}
+
+func (d *DDBLeaseStore) DeleteLease(ctx context.Context, streamARN string, shardID string, counter int64) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: d.tableName,
+		Key: map[string]ddbTypes.AttributeValue{
+			"PK": &ddbTypes.AttributeValueMemberS{Value: leasePK(streamARN)},
+			"SK": &ddbTypes.AttributeValueMemberS{Value: leaseSK(shardID)},
+		},
+		ConditionExpression: aws.String("#counter = :counter"),
+		ExpressionAttributeNames: map[string]string{
+			"#counter": "Counter",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":counter": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(counter, 10)},
+		},
+	})
+	if err != nil {
+		var ccf *ddbTypes.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrLeaseConflict
+		}
+		return fmt.Errorf("ddb.DeleteItem: %w", err)
+	}
+
+	return nil
+}
+
+func leasePK(streamARN string) string {
+	return "Lease#" + streamARN
+}
+
+func leaseSK(shardID string) string {
+	return "Shard#" + shardID
+}
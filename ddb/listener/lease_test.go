@@ -0,0 +1,234 @@
+package listener
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryLeaseStore struct {
+	mutex sync.Mutex
+	data  map[string]Lease
+}
+
+func (m *memoryLeaseStore) ListLeases(_ context.Context, _ string) (leases []Lease, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, lease := range m.data {
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+func (m *memoryLeaseStore) PutLease(_ context.Context, _ string, lease Lease, counter int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.data == nil {
+		m.data = map[string]Lease{}
+	}
+	if got := m.data[lease.ShardID].Counter; got != counter {
+		return ErrLeaseConflict
+	}
+	m.data[lease.ShardID] = lease
+	return nil
+}
+
+func (m *memoryLeaseStore) DeleteLease(_ context.Context, _ string, shardID string, counter int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if got := m.data[shardID].Counter; got != counter {
+		return ErrLeaseConflict
+	}
+	delete(m.data, shardID)
+	return nil
+}
+
+// blockingLeaseStore blocks the first write of the lease for shardID until
+// unblock is closed, closing blocked once the write is pending.
+type blockingLeaseStore struct {
+	*memoryLeaseStore
+	shardID string
+	once    sync.Once
+	blocked chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingLeaseStore) PutLease(ctx context.Context, streamARN string, lease Lease, counter int64) error {
+	if lease.ShardID == b.shardID {
+		b.once.Do(func() {
+			close(b.blocked)
+			<-b.unblock
+		})
+	}
+	return b.memoryLeaseStore.PutLease(ctx, streamARN, lease, counter)
+}
+
+func Test_LeaseManager(t *testing.T) {
+	ctx := context.Background()
+	shardIDs := []string{"A", "B", "C", "D"}
+
+	t.Run("single worker takes all shards", func(t *testing.T) {
+		m := NewLeaseManager(&memoryLeaseStore{}, "w1", time.Minute)
+		owned, _, err := m.sync(ctx, "arn", shardIDs)
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if !reflect.DeepEqual(owned, shardIDs) {
+			t.Fatalf("got %v; want %v", owned, shardIDs)
+		}
+	})
+
+	t.Run("rebalances when a worker joins", func(t *testing.T) {
+		store := &memoryLeaseStore{}
+		w1 := NewLeaseManager(store, "w1", time.Minute)
+		w2 := NewLeaseManager(store, "w2", time.Minute)
+
+		if _, _, err := w1.sync(ctx, "arn", shardIDs); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, _, err := w2.sync(ctx, "arn", shardIDs); err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+		}
+
+		lost, err := w1.renew(ctx, "arn")
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if got, want := len(lost), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		owned1, _, _ := w1.sync(ctx, "arn", shardIDs)
+		owned2, _, _ := w2.sync(ctx, "arn", shardIDs)
+		if got, want := len(owned1), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if got, want := len(owned2), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("takes expired leases", func(t *testing.T) {
+		store := &memoryLeaseStore{}
+		w1 := NewLeaseManager(store, "w1", time.Minute)
+		w2 := NewLeaseManager(store, "w2", time.Minute)
+		offset := time.Duration(0)
+		w2.now = func() time.Time { return time.Now().Add(offset) }
+
+		w1.sync(ctx, "arn", shardIDs)
+		w2.sync(ctx, "arn", shardIDs)
+		offset = 2 * time.Minute
+		w2.renew(ctx, "arn")
+		owned, _, _ := w2.sync(ctx, "arn", shardIDs)
+		if !reflect.DeepEqual(owned, shardIDs) {
+			t.Fatalf("got %v; want %v", owned, shardIDs)
+		}
+	})
+
+	t.Run("expiry ignores the owner's clock", func(t *testing.T) {
+		store := &memoryLeaseStore{}
+		w1 := NewLeaseManager(store, "w1", time.Minute)
+		w1.now = func() time.Time { return time.Now().Add(-5 * time.Minute) }
+		w2 := NewLeaseManager(store, "w2", time.Minute)
+		offset := time.Duration(0)
+		w2.now = func() time.Time { return time.Now().Add(offset) }
+		shardIDs := []string{"A"}
+
+		w1.sync(ctx, "arn", shardIDs)
+		if owned, _, _ := w2.sync(ctx, "arn", shardIDs); len(owned) != 0 {
+			t.Fatalf("got %v; want none", owned)
+		}
+
+		// renewed leases are kept however far behind the owner's clock is
+		if _, err := w1.renew(ctx, "arn"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		offset = 2 * time.Minute
+		if owned, _, _ := w2.sync(ctx, "arn", shardIDs); len(owned) != 0 {
+			t.Fatalf("got %v; want none", owned)
+		}
+
+		offset = 4 * time.Minute
+		owned, _, _ := w2.sync(ctx, "arn", shardIDs)
+		if !reflect.DeepEqual(owned, shardIDs) {
+			t.Fatalf("got %v; want %v", owned, shardIDs)
+		}
+	})
+
+	t.Run("completed shards are reported", func(t *testing.T) {
+		store := &memoryLeaseStore{}
+		w1 := NewLeaseManager(store, "w1", time.Minute)
+		w2 := NewLeaseManager(store, "w2", time.Minute)
+
+		w1.sync(ctx, "arn", shardIDs)
+		if err := w1.complete(ctx, "arn", "A"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		_, completed, _ := w2.sync(ctx, "arn", shardIDs)
+		if want := []string{"A"}; !reflect.DeepEqual(completed, want) {
+			t.Fatalf("got %v; want %v", completed, want)
+		}
+	})
+	t.Run("completed leases are deleted after retention", func(t *testing.T) {
+		store := &memoryLeaseStore{}
+		w1 := NewLeaseManager(store, "w1", time.Minute)
+		w2 := NewLeaseManager(store, "w2", time.Minute)
+		w2.now = func() time.Time { return time.Now().Add(completedLeaseRetention + time.Minute) }
+
+		w1.sync(ctx, "arn", shardIDs)
+		if err := w1.complete(ctx, "arn", "A"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		w2.sync(ctx, "arn", shardIDs[1:])
+		if _, ok := store.data["A"]; ok {
+			t.Fatalf("got lease for A; want deleted")
+		}
+	})
+
+	t.Run("renewing doesn't hold up other shards", func(t *testing.T) {
+		store := &blockingLeaseStore{memoryLeaseStore: &memoryLeaseStore{}}
+		m := NewLeaseManager(store, "w1", time.Minute)
+		if _, _, err := m.sync(ctx, "arn", []string{"A", "B"}); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		store.shardID = "A"
+		store.blocked = make(chan struct{})
+		store.unblock = make(chan struct{})
+		renewed := make(chan error)
+		go func() {
+			_, err := m.renew(ctx, "arn")
+			renewed <- err
+		}()
+		<-store.blocked
+
+		if err := m.release(ctx, "arn", "B"); err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+
+		completed := make(chan error)
+		go func() {
+			completed <- m.complete(ctx, "arn", "A")
+		}()
+		close(store.unblock)
+
+		if err := <-renewed; err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if err := <-completed; err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if lease := store.data["A"]; !lease.Completed || lease.Counter != 3 {
+			t.Fatalf("got %+v; want completed at counter 3", lease)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package listener
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics records observations about a Subscriber.
+type Metrics interface {
+	// IteratorAge records how far behind the shard is: the age of the most
+	// recent record read from it, or zero once it has caught up.
+	IteratorAge(shardID string, age time.Duration)
+
+	// Batch records a batch delivered to the callback, its size and how long
+	// the callback took. err is non-nil if any record of the batch failed.
+	Batch(size int, latency time.Duration, err error)
+
+	// Retry records a failed batch that will be retried.
+	Retry()
+
+	// GiveUp records n records given up on after exhausting retries.
+	GiveUp(n int)
+
+	// ActiveShards records the number of shards being read.
+	ActiveShards(n int)
+
+	// ShardCompleted records a shard that has been read to the end.
+	ShardCompleted(shardID string)
+
+	// ShardStopped records that the shard is no longer read, whether it was
+	// completed, failed, lost to another worker or the subscriber stopped.
+	// Series kept per shard should be removed.
+	ShardStopped(shardID string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IteratorAge(string, time.Duration) {}
+func (nopMetrics) Batch(int, time.Duration, error)   {}
+func (nopMetrics) Retry()                            {}
+func (nopMetrics) GiveUp(int)                        {}
+func (nopMetrics) ActiveShards(int)                  {}
+func (nopMetrics) ShardCompleted(string)             {}
+func (nopMetrics) ShardStopped(string)               {}
+
+// MemoryMetrics keeps metrics in memory and serves them in the Prometheus text
+// exposition format.
+//
+//	metrics := listener.NewMemoryMetrics()
+//	http.Handle("/metrics", metrics)
+type MemoryMetrics struct {
+	mutex           sync.Mutex
+	iteratorAge     map[string]time.Duration
+	batches         int64
+	batchRecords    int64
+	batchErrors     int64
+	handlerLatency  time.Duration
+	retries         int64
+	giveUps         int64
+	activeShards    int
+	completedShards int64
+}
+
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		iteratorAge: map[string]time.Duration{},
+	}
+}
+
+func (m *MemoryMetrics) IteratorAge(shardID string, age time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.iteratorAge[shardID] = age
+}
+
+func (m *MemoryMetrics) Batch(size int, latency time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.batches++
+	m.batchRecords += int64(size)
+	m.handlerLatency += latency
+	if err != nil {
+		m.batchErrors++
+	}
+}
+
+func (m *MemoryMetrics) Retry() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.retries++
+}
+
+func (m *MemoryMetrics) GiveUp(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.giveUps += int64(n)
+}
+
+func (m *MemoryMetrics) ActiveShards(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.activeShards = n
+}
+
+func (m *MemoryMetrics) ShardCompleted(shardID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.completedShards++
+}
+
+func (m *MemoryMetrics) ShardStopped(shardID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.iteratorAge, shardID)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format.
+func (m *MemoryMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var buf bytes.Buffer
+
+	shardIDs := make([]string, 0, len(m.iteratorAge))
+	for shardID := range m.iteratorAge {
+		shardIDs = append(shardIDs, shardID)
+	}
+	sort.Strings(shardIDs)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_iterator_age_seconds Age of the most recent record read from the shard.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_iterator_age_seconds gauge")
+	for _, shardID := range shardIDs {
+		fmt.Fprintf(&buf, "ddbstream_iterator_age_seconds{shard=%q} %v\n", shardID, m.iteratorAge[shardID].Seconds())
+	}
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_batch_records Records delivered per batch.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_batch_records summary")
+	fmt.Fprintf(&buf, "ddbstream_batch_records_sum %v\n", m.batchRecords)
+	fmt.Fprintf(&buf, "ddbstream_batch_records_count %v\n", m.batches)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_handler_latency_seconds Time taken by the callback per batch.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_handler_latency_seconds summary")
+	fmt.Fprintf(&buf, "ddbstream_handler_latency_seconds_sum %v\n", m.handlerLatency.Seconds())
+	fmt.Fprintf(&buf, "ddbstream_handler_latency_seconds_count %v\n", m.batches)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_handler_errors_total Batches in which at least one record failed.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_handler_errors_total counter")
+	fmt.Fprintf(&buf, "ddbstream_handler_errors_total %v\n", m.batchErrors)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_retries_total Failed batches that were retried.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_retries_total counter")
+	fmt.Fprintf(&buf, "ddbstream_retries_total %v\n", m.retries)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_giveups_total Records given up on after exhausting retries.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_giveups_total counter")
+	fmt.Fprintf(&buf, "ddbstream_giveups_total %v\n", m.giveUps)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_active_shards Shards being read.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_active_shards gauge")
+	fmt.Fprintf(&buf, "ddbstream_active_shards %v\n", m.activeShards)
+
+	fmt.Fprintln(&buf, "# HELP ddbstream_completed_shards_total Shards read to the end.")
+	fmt.Fprintln(&buf, "# TYPE ddbstream_completed_shards_total counter")
+	fmt.Fprintf(&buf, "ddbstream_completed_shards_total %v\n", m.completedShards)
+
+	return buf.WriteTo(w)
+}
+
+func (m *MemoryMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
@@ -0,0 +1,47 @@
+package listener
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MemoryMetrics(t *testing.T) {
+	m := NewMemoryMetrics()
+	m.IteratorAge("A", 2*time.Second)
+	m.IteratorAge("B", time.Second)
+	m.Batch(10, time.Second, nil)
+	m.Batch(5, time.Second, io.EOF)
+	m.Retry()
+	m.GiveUp(5)
+	m.ActiveShards(2)
+	m.ShardCompleted("B")
+	m.ShardStopped("B")
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		`ddbstream_iterator_age_seconds{shard="A"} 2`,
+		"ddbstream_batch_records_sum 15\n",
+		"ddbstream_batch_records_count 2\n",
+		"ddbstream_handler_latency_seconds_sum 2\n",
+		"ddbstream_handler_errors_total 1\n",
+		"ddbstream_retries_total 1\n",
+		"ddbstream_giveups_total 5\n",
+		"ddbstream_active_shards 2\n",
+		"ddbstream_completed_shards_total 1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("got %v; want contains %v", got, want)
+		}
+	}
+	if strings.Contains(got, `shard="B"`) {
+		t.Fatalf("got %v; want stopped shard removed", got)
+	}
+}
@@ -1,9 +1,12 @@
 package listener
 
 import (
+	"bytes"
+	"log/slog"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/internal/logging"
 )
 
 const (
@@ -13,25 +16,69 @@ const (
 )
 
 type Options struct {
-	batchSize         int
-	maxBatchWait      time.Duration
-	debug             func(format string, args ...interface{})
-	pollInterval      time.Duration
-	shardIteratorType string
-	retryCount        int
+	batchSize        int
+	maxBatchWait     time.Duration
+	logger           *slog.Logger
+	pollInterval     time.Duration
+	start            startPosition
+	filters          eventFilters
+	filterErr        error
+	retryCount       int
+	checkpoints      CheckpointStore
+	leases           *LeaseManager
+	deadLetter       DeadLetterSink
+	retryPolicy      RetryPolicy
+	shardRetryPolicy RetryPolicy
+	parallelism      int
+	errorPolicy      ErrorPolicy
+	onError          func(err error)
+	metrics          Metrics
 }
 
 type Option func(*Options)
 
+// ErrorPolicy determines how a Subscriber reacts to a shard that cannot be
+// read or records that cannot be dead lettered.
+type ErrorPolicy int
+
+const (
+	// StopOnError stops the subscriber on the first failure. The error is
+	// returned by Err and Close.
+	StopOnError ErrorPolicy = iota
+
+	// ContinueOnError reports failures to the error handler and keeps going.
+	// Failed shards, and shards with records that could not be dead lettered,
+	// are read again from their checkpoint on the next scan.
+	ContinueOnError
+)
+
 func WithBatchSize(n int) Option {
 	return func(o *Options) {
 		o.batchSize = n
 	}
 }
 
+// WithDebug passes each log line, at every level, to fn. Prefer WithLogger.
 func WithDebug(fn func(format string, args ...interface{})) Option {
 	return func(o *Options) {
-		o.debug = fn
+		o.logger = slog.New(slog.NewTextHandler(debugWriter(fn), &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+}
+
+// debugWriter adapts a printf-style func to the io.Writer used by a slog
+// handler, which writes one line per record.
+type debugWriter func(format string, args ...interface{})
+
+func (fn debugWriter) Write(p []byte) (int, error) {
+	fn("%s", bytes.TrimSuffix(p, []byte("\n")))
+	return len(p), nil
+}
+
+// WithLogger sets the logger used by the subscriber. By default nothing is
+// logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.logger = logger
 	}
 }
 
@@ -41,9 +88,147 @@ func WithRetryCount(n int) Option {
 	}
 }
 
+// WithCheckpointStore sets the store used to record and resume the position
+// within each shard. Defaults to an in-memory store.
+func WithCheckpointStore(store CheckpointStore) Option {
+	return func(o *Options) {
+		o.checkpoints = store
+	}
+}
+
+// WithLeaseManager coordinates shard ownership with other workers subscribed
+// to the same stream so that each shard is read by a single worker.
+func WithLeaseManager(m *LeaseManager) Option {
+	return func(o *Options) {
+		o.leases = m
+	}
+}
+
+// WithDeadLetter sends records to sink once the callback has failed
+// retryCount times, rather than discarding them.
+func WithDeadLetter(sink DeadLetterSink) Option {
+	return func(o *Options) {
+		o.deadLetter = sink
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed callbacks. It takes
+// precedence over WithRetryCount.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *Options) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithShardRetryPolicy sets the policy used to retry failed reads from a shard.
+// Defaults to exponential backoff on the errors classified by
+// RetryableStreamError.
+func WithShardRetryPolicy(policy RetryPolicy) Option {
+	return func(o *Options) {
+		o.shardRetryPolicy = policy
+	}
+}
+
+// WithParallelism delivers batches to the callback from n workers
+// concurrently. Records sharing a PK are always delivered by the same worker,
+// in the order they were written, including across parent and child shards.
+func WithParallelism(n int) Option {
+	return func(o *Options) {
+		o.parallelism = n
+	}
+}
+
+// WithErrorPolicy sets how the subscriber reacts to failures. Defaults to
+// StopOnError.
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(o *Options) {
+		o.errorPolicy = policy
+	}
+}
+
+// WithErrorHandler registers fn to be called with every error the subscriber
+// encounters, including those that do not stop it.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(o *Options) {
+		o.onError = fn
+	}
+}
+
+// WithMetrics records observations about the subscriber, such as how far
+// behind each shard is, to m.
+func WithMetrics(m Metrics) Option {
+	return func(o *Options) {
+		o.metrics = m
+	}
+}
+
+// WithFilter only delivers records matching any of the given patterns, using
+// the syntax of Lambda event filtering. Records that do not match are skipped
+// before they are batched, and checkpointed along with the records around
+// them.
+//
+//	listener.WithFilter(`{"eventName": ["INSERT"], "dynamodb": {"NewImage": {"Type": {"S": ["User"]}}}}`)
+//
+// Invalid patterns are reported by Subscribe.
+func WithFilter(patterns ...string) Option {
+	return func(o *Options) {
+		for _, pattern := range patterns {
+			f, err := parseFilter(pattern)
+			if err != nil {
+				o.filterErr = err
+				return
+			}
+			o.filters = append(o.filters, f)
+		}
+	}
+}
+
+// WithIteratorType starts shards without a checkpoint at the given shard
+// iterator type, LATEST or TRIM_HORIZON. Prefer StartAtLatest and
+// StartAtTrimHorizon.
 func WithIteratorType(shardIteratorType string) Option {
 	return func(o *Options) {
-		o.shardIteratorType = shardIteratorType
+		o.start = startPosition{iteratorType: types.ShardIteratorType(shardIteratorType)}
+	}
+}
+
+// StartAtLatest starts shards without a checkpoint after the most recent
+// record, so only new changes are delivered. This is the default.
+func StartAtLatest() Option {
+	return func(o *Options) {
+		o.start = startPosition{iteratorType: types.ShardIteratorTypeLatest}
+	}
+}
+
+// StartAtTrimHorizon starts shards without a checkpoint at the oldest record
+// still in the stream, up to 24 hours old.
+func StartAtTrimHorizon() Option {
+	return func(o *Options) {
+		o.start = startPosition{iteratorType: types.ShardIteratorTypeTrimHorizon}
+	}
+}
+
+// StartAtTime starts shards without a checkpoint at the oldest record in the
+// stream and skips records created before t.
+func StartAtTime(t time.Time) Option {
+	return func(o *Options) {
+		o.start = startPosition{iteratorType: types.ShardIteratorTypeTrimHorizon, time: t}
+	}
+}
+
+// StartAt starts each shard in sequenceNumbers, keyed by shard id, at the
+// given sequence number, to replay a stream from a known point. The ancestors
+// of those shards are not read; any other shard is read from its oldest
+// record. Shards with a checkpoint resume from it.
+func StartAt(sequenceNumbers map[string]string) Option {
+	return func(o *Options) {
+		o.start = startPosition{
+			iteratorType:    types.ShardIteratorTypeTrimHorizon,
+			sequenceNumbers: sequenceNumbers,
+		}
+		if o.start.sequenceNumbers == nil {
+			o.start.sequenceNumbers = map[string]string{}
+		}
 	}
 }
 
@@ -69,8 +254,14 @@ func buildOptions(opts ...Option) Options {
 		options.batchSize = defaultBatchSize
 	}
 
-	if options.debug == nil {
-		options.debug = func(format string, args ...interface{}) {}
+	options.logger = logging.OrDiscard(options.logger)
+
+	if options.onError == nil {
+		options.onError = func(err error) {}
+	}
+
+	if options.metrics == nil {
+		options.metrics = nopMetrics{}
 	}
 
 	if options.pollInterval <= 0 {
@@ -81,13 +272,37 @@ func buildOptions(opts ...Option) Options {
 		options.retryCount = defaultRetryCount
 	}
 
+	if options.parallelism <= 0 {
+		options.parallelism = 1
+	}
+
+	if options.retryPolicy == nil {
+		options.retryPolicy = defaultCallbackRetryPolicy(options.retryCount)
+	}
+
+	if options.shardRetryPolicy == nil {
+		options.shardRetryPolicy = defaultShardRetryPolicy()
+	}
+
 	if options.maxBatchWait <= 0 {
 		options.maxBatchWait = defaultInterval
 	}
 
-	if options.shardIteratorType == "" {
-		options.shardIteratorType = string(types.ShardIteratorTypeLatest)
+	if options.start.iteratorType == "" {
+		options.start.iteratorType = types.ShardIteratorTypeLatest
+	}
+
+	if options.checkpoints == nil {
+		options.checkpoints = NewMemoryCheckpointStore()
 	}
 
 	return options
 }
+
+// validate reports options that cannot be used to subscribe.
+func (o Options) validate() error {
+	if o.filterErr != nil {
+		return o.filterErr
+	}
+	return o.start.validate()
+}
@@ -1 +1,23 @@
 package listener
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_WithDebug(t *testing.T) {
+	var lines []string
+	options := buildOptions(WithDebug(func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}))
+
+	options.logger.Debug("shard started", "shardID", "A")
+
+	if got, want := len(lines), 1; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := lines[0], `msg="shard started" shardID=A`; !strings.HasSuffix(got, want) {
+		t.Fatalf("got %v; want suffix %v", got, want)
+	}
+}
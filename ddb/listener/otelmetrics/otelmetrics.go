@@ -0,0 +1,150 @@
+// Package otelmetrics records listener metrics with OpenTelemetry.
+package otelmetrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/code-inbox/mason-go/ddb/listener"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics implements listener.Metrics using instruments created from an
+// OpenTelemetry meter.
+//
+//	m, err := otelmetrics.New(otel.Meter("ddbstream"))
+//	stream := listener.New(ddbClient, streamsClient, &tableName, listener.WithMetrics(m))
+type Metrics struct {
+	batchRecords    metric.Int64Histogram
+	handlerLatency  metric.Float64Histogram
+	handlerErrors   metric.Int64Counter
+	retries         metric.Int64Counter
+	giveUps         metric.Int64Counter
+	completedShards metric.Int64Counter
+
+	mutex        sync.Mutex
+	iteratorAge  map[string]time.Duration
+	activeShards int64
+}
+
+var _ listener.Metrics = (*Metrics)(nil)
+
+func New(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{
+		iteratorAge: map[string]time.Duration{},
+	}
+
+	var err error
+	if m.batchRecords, err = meter.Int64Histogram("ddbstream.batch.records",
+		metric.WithDescription("Records delivered per batch."),
+		metric.WithUnit("{record}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	if m.handlerLatency, err = meter.Float64Histogram("ddbstream.handler.latency",
+		metric.WithDescription("Time taken by the callback per batch."),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	if m.handlerErrors, err = meter.Int64Counter("ddbstream.handler.errors",
+		metric.WithDescription("Batches in which at least one record failed."),
+		metric.WithUnit("{batch}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	if m.retries, err = meter.Int64Counter("ddbstream.retries",
+		metric.WithDescription("Failed batches that were retried."),
+		metric.WithUnit("{batch}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	if m.giveUps, err = meter.Int64Counter("ddbstream.giveups",
+		metric.WithDescription("Records given up on after exhausting retries."),
+		metric.WithUnit("{record}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	if m.completedShards, err = meter.Int64Counter("ddbstream.shards.completed",
+		metric.WithDescription("Shards read to the end."),
+		metric.WithUnit("{shard}"),
+	); err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+
+	iteratorAge, err := meter.Float64ObservableGauge("ddbstream.iterator.age",
+		metric.WithDescription("Age of the most recent record read from the shard."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+	activeShards, err := meter.Int64ObservableGauge("ddbstream.shards.active",
+		metric.WithDescription("Shards being read."),
+		metric.WithUnit("{shard}"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create instrument: %w", err)
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		for shardID, age := range m.iteratorAge {
+			o.ObserveFloat64(iteratorAge, age.Seconds(), metric.WithAttributes(attribute.String("shard", shardID)))
+		}
+		o.ObserveInt64(activeShards, m.activeShards)
+		return nil
+	}, iteratorAge, activeShards)
+	if err != nil {
+		return nil, fmt.Errorf("unable to register callback: %w", err)
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) IteratorAge(shardID string, age time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.iteratorAge[shardID] = age
+}
+
+func (m *Metrics) Batch(size int, latency time.Duration, err error) {
+	ctx := context.Background()
+	m.batchRecords.Record(ctx, int64(size))
+	m.handlerLatency.Record(ctx, latency.Seconds())
+	if err != nil {
+		m.handlerErrors.Add(ctx, 1)
+	}
+}
+
+func (m *Metrics) Retry() {
+	m.retries.Add(context.Background(), 1)
+}
+
+func (m *Metrics) GiveUp(n int) {
+	m.giveUps.Add(context.Background(), int64(n))
+}
+
+func (m *Metrics) ActiveShards(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.activeShards = int64(n)
+}
+
+func (m *Metrics) ShardCompleted(shardID string) {
+	m.completedShards.Add(context.Background(), 1)
+}
+
+func (m *Metrics) ShardStopped(shardID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.iteratorAge, shardID)
+}
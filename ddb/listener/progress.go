@@ -0,0 +1,136 @@
+package listener
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// progress tracks the records of each shard that are in flight. Batches may
+// complete out of order when delivered in parallel, so a shard is only
+// checkpointed up to the first record that has not yet completed.
+type progress struct {
+	mutex   sync.Mutex
+	pending map[string][]*shardRecord
+	done    map[*shardRecord]bool // tracked records, true once completed
+	idle    map[string][]chan struct{}
+}
+
+// add records r as in flight. Records must be added in the order they were
+// read from the shard.
+func (p *progress) add(r *shardRecord) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.pending == nil {
+		p.pending = map[string][]*shardRecord{}
+		p.done = map[*shardRecord]bool{}
+		p.idle = map[string][]chan struct{}{}
+	}
+	p.pending[r.shardID] = append(p.pending[r.shardID], r)
+	p.done[r] = false
+}
+
+// skip records r, which is not delivered, as completed, so the shard is
+// checkpointed past it once the records before it complete. Returns true if
+// no earlier record is in flight, in which case the caller checkpoints it.
+func (p *progress) skip(r *shardRecord) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pending := p.pending[r.shardID]
+	if len(pending) == 0 {
+		return true
+	}
+
+	// a completed record at the end is superseded by r, so a run of skipped
+	// records is only tracked once
+	if last := pending[len(pending)-1]; p.done[last] {
+		delete(p.done, last)
+		pending = pending[:len(pending)-1]
+	}
+	p.pending[r.shardID] = append(pending, r)
+	p.done[r] = true
+	return false
+}
+
+// complete marks records as processed and returns, for each shard that
+// advanced, the sequence number of its last contiguously completed record.
+// Records that are not tracked, because their shard was reset, are ignored.
+func (p *progress) complete(records []*shardRecord) map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	shards := map[string]struct{}{}
+	for _, r := range records {
+		if _, ok := p.done[r]; !ok {
+			continue
+		}
+		p.done[r] = true
+		shards[r.shardID] = struct{}{}
+	}
+
+	advanced := map[string]string{}
+	for shardID := range shards {
+		pending := p.pending[shardID]
+		n := 0
+		for n < len(pending) && p.done[pending[n]] {
+			delete(p.done, pending[n])
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+
+		advanced[shardID] = aws.ToString(pending[n-1].record.Dynamodb.SequenceNumber)
+		if n == len(pending) {
+			p.release(shardID)
+		} else {
+			p.pending[shardID] = pending[n:]
+		}
+	}
+
+	return advanced
+}
+
+// wait blocks until every record added for the shard has completed.
+func (p *progress) wait(ctx context.Context, shardID string) error {
+	p.mutex.Lock()
+	if len(p.pending[shardID]) == 0 {
+		p.mutex.Unlock()
+		return nil
+	}
+	idle := make(chan struct{})
+	p.idle[shardID] = append(p.idle[shardID], idle)
+	p.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reset forgets the records of the shard, so a shard that is read again from
+// its checkpoint isn't held back by records of the previous read. Records
+// that complete afterwards are ignored.
+func (p *progress) reset(shardID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, r := range p.pending[shardID] {
+		delete(p.done, r)
+	}
+	p.release(shardID)
+}
+
+// release drops the shard's pending records and wakes up those waiting on it.
+func (p *progress) release(shardID string) {
+	delete(p.pending, shardID)
+	for _, idle := range p.idle[shardID] {
+		close(idle)
+	}
+	delete(p.idle, shardID)
+}
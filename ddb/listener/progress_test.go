@@ -0,0 +1,110 @@
+package listener
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_progress(t *testing.T) {
+	var (
+		a1 = &shardRecord{shardID: "A", record: newRecord("1")}
+		a2 = &shardRecord{shardID: "A", record: newRecord("2")}
+		a3 = &shardRecord{shardID: "A", record: newRecord("3")}
+		b1 = &shardRecord{shardID: "B", record: newRecord("4")}
+	)
+
+	var p progress
+	for _, r := range []*shardRecord{a1, b1, a2, a3} {
+		p.add(r)
+	}
+
+	if got, want := p.complete([]*shardRecord{a2, b1}), map[string]string{"B": "4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := p.complete([]*shardRecord{a1}), map[string]string{"A": "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := p.complete([]*shardRecord{a3}), map[string]string{"A": "3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if len(p.pending) != 0 || len(p.done) != 0 {
+		t.Fatalf("got %v pending, %v done; want none", len(p.pending), len(p.done))
+	}
+}
+
+func Test_progress_wait(t *testing.T) {
+	ctx := context.Background()
+	a1 := &shardRecord{shardID: "A", record: newRecord("1")}
+
+	var p progress
+	if err := p.wait(ctx, "A"); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	p.add(a1)
+	waited := make(chan error, 1)
+	go func() {
+		waited <- p.wait(ctx, "A")
+	}()
+
+	select {
+	case err := <-waited:
+		t.Fatalf("got %v; want wait until completed", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	p.complete([]*shardRecord{a1})
+	if err := <-waited; err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+}
+
+func Test_progress_reset(t *testing.T) {
+	var (
+		a1 = &shardRecord{shardID: "A", record: newRecord("1")}
+		a2 = &shardRecord{shardID: "A", record: newRecord("2")}
+	)
+
+	var p progress
+	p.add(a1)
+	p.reset("A")
+	p.add(a2)
+
+	if got := p.complete([]*shardRecord{a1}); len(got) != 0 {
+		t.Fatalf("got %v; want none", got)
+	}
+	if got, want := p.complete([]*shardRecord{a2}), map[string]string{"A": "2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_progress_skip(t *testing.T) {
+	var (
+		a1 = &shardRecord{shardID: "A", record: newRecord("1")}
+		a2 = &shardRecord{shardID: "A", record: newRecord("2")}
+		a3 = &shardRecord{shardID: "A", record: newRecord("3")}
+		a4 = &shardRecord{shardID: "A", record: newRecord("4")}
+	)
+
+	var p progress
+	if !p.skip(a1) {
+		t.Fatalf("got false; want true")
+	}
+
+	p.add(a2)
+	if p.skip(a3) || p.skip(a4) {
+		t.Fatalf("got true; want false")
+	}
+	if got, want := len(p.pending["A"]), 2; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	if got, want := p.complete([]*shardRecord{a2}), map[string]string{"A": "4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if len(p.pending) != 0 || len(p.done) != 0 {
+		t.Fatalf("got %v pending, %v done; want none", len(p.pending), len(p.done))
+	}
+}
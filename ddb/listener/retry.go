@@ -0,0 +1,104 @@
+package listener
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/smithy-go"
+)
+
+// RetryPolicy decides whether a failed operation should be retried and how
+// long to wait beforehand.
+type RetryPolicy interface {
+	// NextDelay returns the delay before the given retry, counting from 1, of an
+	// operation that has been failing for elapsed. ok is false when the
+	// operation should not be retried.
+	NextDelay(retry int, elapsed time.Duration, err error) (delay time.Duration, ok bool)
+}
+
+// ExponentialBackoff multiplies the delay between retries by Multiplier, up to
+// MaxInterval, randomising each delay by ±Jitter (a fraction between 0 and 1).
+// Zero values for MaxInterval, MaxElapsedTime and MaxRetries impose no limit.
+type ExponentialBackoff struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	MaxElapsedTime  time.Duration
+	MaxRetries      int
+
+	// Retryable classifies errors; all errors are retried when nil.
+	Retryable func(err error) bool
+}
+
+func (b ExponentialBackoff) NextDelay(retry int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if b.Retryable != nil && !b.Retryable(err) {
+		return 0, false
+	}
+	if b.MaxRetries > 0 && retry > b.MaxRetries {
+		return 0, false
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(b.InitialInterval) * math.Pow(multiplier, float64(retry-1))
+	if b.MaxInterval > 0 && delay > float64(b.MaxInterval) {
+		delay = float64(b.MaxInterval)
+	}
+	if b.Jitter > 0 {
+		delay *= 1 - b.Jitter + 2*b.Jitter*rand.Float64()
+	}
+
+	if b.MaxElapsedTime > 0 && elapsed+time.Duration(delay) > b.MaxElapsedTime {
+		return 0, false
+	}
+	return time.Duration(delay), true
+}
+
+// RetryableStreamError reports whether err is a transient error from the
+// DynamoDB Streams API: rate limiting, throttling, expired iterators and
+// internal server errors.
+func RetryableStreamError(err error) bool {
+	var (
+		limitExceeded   *types.LimitExceededException
+		expiredIterator *types.ExpiredIteratorException
+		internalError   *types.InternalServerError
+	)
+	if errors.As(err, &limitExceeded) || errors.As(err, &expiredIterator) || errors.As(err, &internalError) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ThrottlingException", "RequestLimitExceeded", "ProvisionedThroughputExceededException":
+			return true
+		}
+	}
+
+	return false
+}
+
+func defaultCallbackRetryPolicy(retryCount int) RetryPolicy {
+	return ExponentialBackoff{
+		InitialInterval: 3 * time.Second,
+		Multiplier:      1,
+		MaxRetries:      retryCount,
+	}
+}
+
+func defaultShardRetryPolicy() RetryPolicy {
+	return ExponentialBackoff{
+		InitialInterval: 2 * time.Second,
+		MaxInterval:     16 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		Retryable:       RetryableStreamError,
+	}
+}
@@ -0,0 +1,107 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func Test_ExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff{
+		InitialInterval: time.Second,
+		MaxInterval:     5 * time.Second,
+		Multiplier:      2,
+		MaxElapsedTime:  time.Minute,
+		MaxRetries:      5,
+	}
+
+	testCases := map[string]struct {
+		Retry   int
+		Elapsed time.Duration
+		Want    time.Duration
+		WantOK  bool
+	}{
+		"first retry": {
+			Retry:  1,
+			Want:   time.Second,
+			WantOK: true,
+		},
+		"third retry": {
+			Retry:  3,
+			Want:   4 * time.Second,
+			WantOK: true,
+		},
+		"capped at max interval": {
+			Retry:  5,
+			Want:   5 * time.Second,
+			WantOK: true,
+		},
+		"max retries": {
+			Retry: 6,
+		},
+		"max elapsed time": {
+			Retry:   1,
+			Elapsed: time.Minute,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			got, ok := backoff.NextDelay(tc.Retry, tc.Elapsed, io.EOF)
+			if got != tc.Want || ok != tc.WantOK {
+				t.Fatalf("got %v, %v; want %v, %v", got, ok, tc.Want, tc.WantOK)
+			}
+		})
+	}
+
+	t.Run("jitter", func(t *testing.T) {
+		backoff := ExponentialBackoff{InitialInterval: time.Second, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			got, _ := backoff.NextDelay(1, 0, io.EOF)
+			if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+				t.Fatalf("got %v; want within 500ms and 1.5s", got)
+			}
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		backoff := ExponentialBackoff{Retryable: RetryableStreamError}
+		if _, ok := backoff.NextDelay(1, 0, io.EOF); ok {
+			t.Fatalf("got true; want false")
+		}
+	})
+}
+
+func Test_RetryableStreamError(t *testing.T) {
+	testCases := map[string]struct {
+		Err  error
+		Want bool
+	}{
+		"limit exceeded": {
+			Err:  fmt.Errorf("wrapped: %w", &types.LimitExceededException{}),
+			Want: true,
+		},
+		"expired iterator": {
+			Err:  fmt.Errorf("wrapped: %w", &types.ExpiredIteratorException{}),
+			Want: true,
+		},
+		"trimmed data": {
+			Err: &types.TrimmedDataAccessException{},
+		},
+		"other": {
+			Err: errors.New("boom"),
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			if got := RetryableStreamError(tc.Err); got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
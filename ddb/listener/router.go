@@ -0,0 +1,152 @@
+package listener
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb"
+)
+
+// Router dispatches records to the handler registered for the Type attribute
+// of their item, as set by ddb.Store.Save. The type is read from the new
+// image, or from the old image of removed items, so the stream must include
+// images.
+//
+//	router := listener.NewRouter()
+//	router.Handle("User", func(ctx context.Context, records []*types.Record) error { ... })
+//	router.Fallback(func(ctx context.Context, records []*types.Record) error { ... })
+//
+//	sub, err := stream.Subscribe(ctx, router)
+//
+// Each batch is split per route, preserving the order of records, and each
+// route is invoked with its own batch. A route that returns an error fails its
+// records, which are retried as partial batch failures. Records with no route
+// and no fallback are skipped.
+type Router struct {
+	routes   map[string]func(streamARN string) invokeFunc
+	fallback func(streamARN string) invokeFunc
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes: map[string]func(streamARN string) invokeFunc{},
+	}
+}
+
+// Handle registers handler for items of the given type. handler accepts any of
+// the signatures accepted by Stream.Subscribe.
+func (r *Router) Handle(typ string, handler interface{}) {
+	r.routes[typ] = func(streamARN string) invokeFunc {
+		return newInvoker(streamARN, handler)
+	}
+}
+
+// Fallback registers handler for records whose type has no route.
+func (r *Router) Fallback(handler interface{}) {
+	r.fallback = func(streamARN string) invokeFunc {
+		return newInvoker(streamARN, handler)
+	}
+}
+
+// HandleTyped registers fn for items of type T, as returned by its GetType,
+// with records unmarshalled into T.
+func HandleTyped[T ddb.Item](r *Router, fn func(ctx context.Context, records []TypedRecord[T]) error) {
+	r.routes[ddb.TypeOf[T]()] = func(streamARN string) invokeFunc {
+		return newTypedInvoker(streamARN, fn)
+	}
+}
+
+func (r *Router) invoker(streamARN string) invokeFunc {
+	routes := make(map[string]invokeFunc, len(r.routes))
+	for typ, route := range r.routes {
+		routes[typ] = route(streamARN)
+	}
+	var fallback invokeFunc
+	if r.fallback != nil {
+		fallback = r.fallback(streamARN)
+	}
+
+	return func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+		var (
+			batches       []*routeBatch
+			byType        = map[string]*routeBatch{}
+			fallbackBatch *routeBatch
+		)
+		for _, record := range records {
+			typ := recordType(record)
+			batch, ok := byType[typ]
+			switch {
+			case ok:
+			case routes[typ] != nil:
+				batch = &routeBatch{invoke: routes[typ]}
+				byType[typ] = batch
+				batches = append(batches, batch)
+			case fallback == nil:
+				continue
+			case fallbackBatch == nil:
+				fallbackBatch = &routeBatch{invoke: fallback}
+				batch = fallbackBatch
+				batches = append(batches, batch)
+			default:
+				batch = fallbackBatch
+			}
+			batch.records = append(batch.records, record)
+		}
+
+		return invokeAll(ctx, batches)
+	}
+}
+
+// routeBatch is the part of a batch delivered to a single route.
+type routeBatch struct {
+	invoke  invokeFunc
+	records []*types.Record
+}
+
+// invokeAll invokes each part of a batch in turn. A part that returns an error
+// fails its records, reported as partial batch failures.
+func invokeAll(ctx context.Context, batches []*routeBatch) (events.DynamoDBEventResponse, error) {
+	var (
+		response events.DynamoDBEventResponse
+		errs     []error
+	)
+	for _, batch := range batches {
+		out, err := batch.invoke(ctx, batch.records)
+		if err != nil {
+			errs = append(errs, err)
+			for _, record := range batch.records {
+				response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+					ItemIdentifier: aws.ToString(record.Dynamodb.SequenceNumber),
+				})
+			}
+			continue
+		}
+		response.BatchItemFailures = append(response.BatchItemFailures, out.BatchItemFailures...)
+	}
+
+	// when every part failed, the errors are more telling than the failures
+	if len(errs) > 0 && len(errs) == len(batches) {
+		return events.DynamoDBEventResponse{}, errors.Join(errs...)
+	}
+	return response, nil
+}
+
+// recordType returns the Type attribute of the item a record changed.
+func recordType(record *types.Record) string {
+	change := record.Dynamodb
+	if change == nil {
+		return ""
+	}
+
+	image := change.NewImage
+	if record.EventName == types.OperationTypeRemove {
+		image = change.OldImage
+	}
+	if v, ok := image["Type"].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func newTypedRecord(sequenceNumber string, eventName types.OperationType, typ string) *types.Record {
+	record := newRecord(sequenceNumber)
+	record.EventName = eventName
+	image := map[string]types.AttributeValue{
+		"Type": &types.AttributeValueMemberS{Value: typ},
+	}
+	if eventName == types.OperationTypeRemove {
+		record.Dynamodb.OldImage = image
+	} else {
+		record.Dynamodb.NewImage = image
+	}
+	return record
+}
+
+func Test_Router(t *testing.T) {
+	ctx := context.Background()
+	records := []*types.Record{
+		newTypedRecord("1", types.OperationTypeInsert, "User"),
+		newTypedRecord("2", types.OperationTypeInsert, "Org"),
+		newTypedRecord("3", types.OperationTypeRemove, "User"),
+		newTypedRecord("4", types.OperationTypeModify, "Invite"),
+		newTypedRecord("5", types.OperationTypeModify, "Org"),
+	}
+
+	calls := map[string][]string{}
+	record := func(route string) func(ctx context.Context, records []*types.Record) error {
+		return func(ctx context.Context, records []*types.Record) error {
+			for _, r := range records {
+				calls[route] = append(calls[route], *r.Dynamodb.SequenceNumber)
+			}
+			if route == "Org" {
+				return errors.New("boom")
+			}
+			return nil
+		}
+	}
+
+	router := NewRouter()
+	router.Handle("User", record("User"))
+	router.Handle("Org", record("Org"))
+	router.Fallback(record("fallback"))
+
+	response, err := newInvoker("arn", router)(ctx, records)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	want := map[string][]string{
+		"User":     {"1", "3"},
+		"Org":      {"2", "5"},
+		"fallback": {"4"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got %v; want %v", calls, want)
+	}
+
+	wantFailures := []events.DynamoDBBatchItemFailure{{ItemIdentifier: "2"}, {ItemIdentifier: "5"}}
+	if !reflect.DeepEqual(response.BatchItemFailures, wantFailures) {
+		t.Fatalf("got %v; want %v", response.BatchItemFailures, wantFailures)
+	}
+}
+
+func Test_Router_noFallback(t *testing.T) {
+	ctx := context.Background()
+
+	var got []string
+	router := NewRouter()
+	HandleTyped(router, func(ctx context.Context, records []TypedRecord[User]) error {
+		for _, r := range records {
+			got = append(got, r.SequenceNumber)
+		}
+		return nil
+	})
+
+	records := []*types.Record{
+		newTypedRecord("1", types.OperationTypeInsert, "Org"),
+		newTypedRecord("2", types.OperationTypeInsert, User{}.GetType()),
+	}
+	if _, err := newInvoker("arn", router)(ctx, records); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if want := []string{"2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_HandleTyped_pointer(t *testing.T) {
+	var got []*User
+	router := NewRouter()
+	HandleTyped(router, func(ctx context.Context, records []TypedRecord[*User]) error {
+		for _, r := range records {
+			got = append(got, *r.NewImage)
+		}
+		return nil
+	})
+
+	records := []*types.Record{newTypedRecord("1", types.OperationTypeInsert, "User")}
+	if _, err := newInvoker("arn", router)(context.Background(), records); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if len(got) != 1 || got[0] == nil {
+		t.Fatalf("got %v; want one user", got)
+	}
+}
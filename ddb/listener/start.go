@@ -0,0 +1,97 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// startPosition determines where shards without a checkpoint are read from.
+type startPosition struct {
+	iteratorType    types.ShardIteratorType
+	time            time.Time
+	sequenceNumbers map[string]string
+}
+
+func (p startPosition) validate() error {
+	switch p.iteratorType {
+	case types.ShardIteratorTypeLatest, types.ShardIteratorTypeTrimHorizon:
+	case types.ShardIteratorTypeAtSequenceNumber, types.ShardIteratorTypeAfterSequenceNumber:
+		return fmt.Errorf("invalid start position, %v: use StartAt to start at a sequence number", p.iteratorType)
+	default:
+		return fmt.Errorf("invalid start position, %v: unknown iterator type", p.iteratorType)
+	}
+
+	if p.sequenceNumbers != nil && len(p.sequenceNumbers) == 0 {
+		return fmt.Errorf("invalid start position: no shards given to StartAt")
+	}
+	for shardID, sequenceNumber := range p.sequenceNumbers {
+		if shardID == "" || sequenceNumber == "" {
+			return fmt.Errorf("invalid start position, %q: shard id and sequence number are required", shardID)
+		}
+	}
+
+	return nil
+}
+
+// iterator returns the iterator type and sequence number a shard without a
+// checkpoint is read from.
+func (p startPosition) iterator(shardID string) (types.ShardIteratorType, *string) {
+	if sequenceNumber, ok := p.sequenceNumbers[shardID]; ok {
+		return types.ShardIteratorTypeAtSequenceNumber, aws.String(sequenceNumber)
+	}
+	return p.iteratorType, nil
+}
+
+// skip reports whether record was created before the start time.
+func (p startPosition) skip(record *types.Record) bool {
+	return createdBefore(record, p.time)
+}
+
+// createdBefore reports whether record was created before t. Records without
+// a creation time, or a zero t, are never before.
+func createdBefore(record *types.Record, t time.Time) bool {
+	if t.IsZero() || record.Dynamodb == nil || record.Dynamodb.ApproximateCreationDateTime == nil {
+		return false
+	}
+	return record.Dynamodb.ApproximateCreationDateTime.Before(t)
+}
+
+// startShards verifies the shards given to StartAt exist in the stream and
+// returns their ancestors, which are not read.
+func (s *Subscriber) startShards(ctx context.Context, streamARN string) ([]string, error) {
+	if len(s.options.start.sequenceNumbers) == 0 {
+		return nil, nil
+	}
+
+	shards, err := s.getShards(ctx, streamARN)
+	if err != nil {
+		return nil, err
+	}
+
+	d := dag{}
+	d.addShards(shards...)
+
+	ancestors := map[string]struct{}{}
+	for shardID := range s.options.start.sequenceNumbers {
+		shard, ok := d[shardID]
+		if !ok {
+			return nil, fmt.Errorf("invalid start position, %v: shard not found in stream, %v", shardID, streamARN)
+		}
+		if parentID := aws.ToString(shard.ParentShardId); parentID != "" {
+			collectAncestors(d, parentID, ancestors)
+		}
+	}
+
+	var ids []string
+	for id := range ancestors {
+		if _, ok := s.options.start.sequenceNumbers[id]; ok {
+			return nil, fmt.Errorf("invalid start position, %v: shard is an ancestor of another shard given to StartAt", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,103 @@
+package listener
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+func Test_startPosition_validate(t *testing.T) {
+	testCases := map[string]struct {
+		Option  Option
+		WantErr bool
+	}{
+		"default": {},
+		"trim horizon": {
+			Option: StartAtTrimHorizon(),
+		},
+		"time": {
+			Option: StartAtTime(time.Now()),
+		},
+		"sequence numbers": {
+			Option: StartAt(map[string]string{"shard": "100"}),
+		},
+		"no shards": {
+			Option:  StartAt(nil),
+			WantErr: true,
+		},
+		"no sequence number": {
+			Option:  StartAt(map[string]string{"shard": ""}),
+			WantErr: true,
+		},
+		"iterator type": {
+			Option: WithIteratorType("TRIM_HORIZON"),
+		},
+		"sequence number iterator type": {
+			Option:  WithIteratorType("AT_SEQUENCE_NUMBER"),
+			WantErr: true,
+		},
+		"unknown iterator type": {
+			Option:  WithIteratorType("EARLIEST"),
+			WantErr: true,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var opts []Option
+			if tc.Option != nil {
+				opts = append(opts, tc.Option)
+			}
+
+			err := buildOptions(opts...).start.validate()
+			if got := err != nil; got != tc.WantErr {
+				t.Fatalf("got %v; want error %v", err, tc.WantErr)
+			}
+		})
+	}
+}
+
+func Test_startPosition_iterator(t *testing.T) {
+	start := buildOptions(StartAt(map[string]string{"A": "100"})).start
+
+	iteratorType, sequenceNumber := start.iterator("A")
+	if iteratorType != types.ShardIteratorTypeAtSequenceNumber || aws.ToString(sequenceNumber) != "100" {
+		t.Fatalf("got %v, %v; want AT_SEQUENCE_NUMBER, 100", iteratorType, aws.ToString(sequenceNumber))
+	}
+
+	iteratorType, sequenceNumber = start.iterator("B")
+	if iteratorType != types.ShardIteratorTypeTrimHorizon || sequenceNumber != nil {
+		t.Fatalf("got %v, %v; want TRIM_HORIZON, nil", iteratorType, sequenceNumber)
+	}
+}
+
+func Test_startPosition_skip(t *testing.T) {
+	now := time.Now()
+	start := buildOptions(StartAtTime(now)).start
+
+	testCases := map[string]struct {
+		Created *time.Time
+		Want    bool
+	}{
+		"before": {
+			Created: aws.Time(now.Add(-time.Minute)),
+			Want:    true,
+		},
+		"after": {
+			Created: aws.Time(now.Add(time.Minute)),
+		},
+		"unknown": {},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			record := newRecord("1")
+			record.Dynamodb.ApproximateCreationDateTime = tc.Created
+			if got := start.skip(record); got != tc.Want {
+				t.Fatalf("got %v; want %v", got, tc.Want)
+			}
+		})
+	}
+}
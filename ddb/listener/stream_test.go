@@ -0,0 +1,234 @@
+package listener
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/code-inbox/mason-go/awslocal"
+)
+
+// testRecord is a record served by a testStream.
+type testRecord struct {
+	sequenceNumber string
+	created        time.Time
+}
+
+// testRecords returns records with the given sequence numbers, created now.
+func testRecords(sequenceNumbers ...string) (records []testRecord) {
+	for _, seq := range sequenceNumbers {
+		records = append(records, testRecord{sequenceNumber: seq, created: time.Now()})
+	}
+	return records
+}
+
+// testShard is a shard served by a testStream. A closed shard ends once its
+// records have been read; an open one waits for more.
+type testShard struct {
+	id       string
+	parentID string
+	records  []testRecord
+	closed   bool
+}
+
+// testStream is a fake DynamoDB and DynamoDB Streams endpoint for the table
+// "table", whose stream "arn" holds shards.
+type testStream struct {
+	t      *testing.T
+	url    string
+	mutex  sync.Mutex
+	shards []*testShard
+
+	// iterators are the iterators requested, as "<shard> <type>" followed by
+	// the sequence number, if any.
+	iterators []string
+
+	// onDescribe is called before answering the nth DescribeStream call.
+	onDescribe func(r *http.Request, n int)
+	describes  int
+
+	// onGetRecords is called, with the stream locked, before answering a
+	// GetRecords call for the shard from pos. A non-empty error code fails the
+	// call with that error.
+	onGetRecords func(shard *testShard, pos int) (errorCode string)
+}
+
+func newTestStream(t *testing.T, shards ...*testShard) *testStream {
+	t.Helper()
+
+	ts := &testStream{t: t, shards: shards}
+	server := httptest.NewServer(http.HandlerFunc(ts.serveHTTP))
+	t.Cleanup(server.Close)
+	ts.url = server.URL
+	return ts
+}
+
+// stream returns a Stream reading from the fake endpoint.
+func (ts *testStream) stream(opts ...Option) *Stream {
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.url, "http://"))
+	cfg, err := awslocal.NewConfig(host, port)
+	if err != nil {
+		ts.t.Fatalf("got %v; want nil", err)
+	}
+
+	api := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	streamAPI := dynamodbstreams.NewFromConfig(cfg, func(o *dynamodbstreams.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	return New(api, streamAPI, aws.String("table"), opts...)
+}
+
+// requested returns the iterators requested so far.
+func (ts *testStream) requested() []string {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	return append([]string(nil), ts.iterators...)
+}
+
+func (ts *testStream) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var input map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		ts.t.Errorf("got %v; want nil", err)
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	op := target[strings.Index(target, ".")+1:]
+	if op == "DescribeStream" {
+		ts.mutex.Lock()
+		ts.describes++
+		n := ts.describes
+		ts.mutex.Unlock()
+
+		if ts.onDescribe != nil {
+			ts.onDescribe(r, n)
+		}
+	}
+
+	ts.mutex.Lock()
+	status, body := ts.respond(op, input)
+	ts.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (ts *testStream) respond(op string, input map[string]interface{}) (int, interface{}) {
+	switch op {
+	case "DescribeTable":
+		return http.StatusOK, map[string]interface{}{
+			"Table": map[string]interface{}{
+				"TableName":           "table",
+				"LatestStreamArn":     "arn",
+				"StreamSpecification": map[string]interface{}{"StreamEnabled": true, "StreamViewType": "KEYS_ONLY"},
+			},
+		}
+
+	case "DescribeStream":
+		var shards []map[string]interface{}
+		for _, shard := range ts.shards {
+			v := map[string]interface{}{"ShardId": shard.id}
+			if shard.parentID != "" {
+				v["ParentShardId"] = shard.parentID
+			}
+			shards = append(shards, v)
+		}
+		return http.StatusOK, map[string]interface{}{
+			"StreamDescription": map[string]interface{}{"StreamArn": "arn", "StreamStatus": "ENABLED", "Shards": shards},
+		}
+
+	case "GetShardIterator":
+		shard := ts.shard(input["ShardId"].(string))
+		iteratorType := input["ShardIteratorType"].(string)
+		sequenceNumber, _ := input["SequenceNumber"].(string)
+		ts.iterators = append(ts.iterators, strings.TrimSpace(shard.id+" "+iteratorType+" "+sequenceNumber))
+
+		pos := 0
+		switch iteratorType {
+		case "LATEST":
+			pos = len(shard.records)
+		case "AT_SEQUENCE_NUMBER", "AFTER_SEQUENCE_NUMBER":
+			for i, r := range shard.records {
+				if r.sequenceNumber == sequenceNumber {
+					pos = i
+				}
+			}
+			if iteratorType == "AFTER_SEQUENCE_NUMBER" {
+				pos++
+			}
+		}
+		return http.StatusOK, map[string]interface{}{"ShardIterator": fmt.Sprintf("%v/%v", shard.id, pos)}
+
+	case "GetRecords":
+		shardID, position, _ := strings.Cut(input["ShardIterator"].(string), "/")
+		shard := ts.shard(shardID)
+		pos, _ := strconv.Atoi(position)
+
+		if ts.onGetRecords != nil {
+			if code := ts.onGetRecords(shard, pos); code != "" {
+				return http.StatusBadRequest, map[string]interface{}{
+					"__type":  "com.amazonaws.dynamodb.v20120810#" + code,
+					"message": code,
+				}
+			}
+		}
+
+		var records []map[string]interface{}
+		for _, r := range shard.records[pos:] {
+			records = append(records, map[string]interface{}{
+				"eventID":   "event-" + r.sequenceNumber,
+				"eventName": "INSERT",
+				"dynamodb": map[string]interface{}{
+					"SequenceNumber":              r.sequenceNumber,
+					"ApproximateCreationDateTime": r.created.Unix(),
+					"Keys":                        map[string]interface{}{"PK": map[string]string{"S": "pk" + r.sequenceNumber}},
+				},
+			})
+		}
+
+		out := map[string]interface{}{"Records": records}
+		if !shard.closed {
+			out["NextShardIterator"] = fmt.Sprintf("%v/%v", shard.id, len(shard.records))
+		}
+		return http.StatusOK, out
+	}
+
+	ts.t.Errorf("got %v; want a supported operation", op)
+	return http.StatusBadRequest, map[string]interface{}{}
+}
+
+func (ts *testStream) shard(id string) *testShard {
+	for _, shard := range ts.shards {
+		if shard.id == id {
+			return shard
+		}
+	}
+	ts.t.Errorf("got shard %v; want one of the test shards", id)
+	return &testShard{id: id}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("got timeout; want %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
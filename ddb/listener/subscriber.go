@@ -5,13 +5,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -41,6 +45,19 @@ func (m *idSet) AddAll(ss ...*types.Shard) {
 	}
 }
 
+func (m *idSet) Add(ids ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, id := range ids {
+		if m.data == nil {
+			m.data = map[string]time.Time{}
+		}
+
+		m.data[id] = time.Now()
+	}
+}
+
 func (m *idSet) Contains(id string) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -89,13 +106,71 @@ func (m *idSet) Slice() (ss []string) {
 	return ss
 }
 
+// cancelSet holds the cancel funcs of running shard goroutines.
+type cancelSet struct {
+	mutex sync.Mutex
+	data  map[string]context.CancelFunc
+}
+
+func (c *cancelSet) Add(id string, cancel context.CancelFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.data == nil {
+		c.data = map[string]context.CancelFunc{}
+	}
+	c.data[id] = cancel
+}
+
+// Cancel stops the goroutine associated with id, if any.
+func (c *cancelSet) Cancel(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if cancel, ok := c.data[id]; ok {
+		cancel()
+		delete(c.data, id)
+	}
+}
+
+func (c *cancelSet) Slice() (ss []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for v := range c.data {
+		ss = append(ss, v)
+	}
+	return ss
+}
+
+// ShardError reports a shard that could not be read.
+type ShardError struct {
+	ShardID string
+	Err     error
+}
+
+func (e *ShardError) Error() string {
+	return fmt.Sprintf("shard %v failed: %v", e.ShardID, e.Err)
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
 type Subscriber struct {
-	stream  *Stream
-	cancel  context.CancelFunc
-	done    chan struct{}
-	err     error
-	invoker invokeFunc
-	options Options
+	stream   *Stream
+	cancel   context.CancelFunc
+	done     chan struct{}
+	drain    chan struct{}
+	draining sync.Once
+	mutex    sync.Mutex
+	err      error
+	invoker  invokeFunc
+	perShard bool
+	options  Options
+	progress progress
+	running  cancelSet
+	skip     []string // shards preceding the start position
 }
 
 func New(api *dynamodb.Client, streamAPI *dynamodbstreams.Client, tableName *string, opts ...Option) *Stream {
@@ -109,6 +184,18 @@ func New(api *dynamodb.Client, streamAPI *dynamodbstreams.Client, tableName *str
 }
 
 func (s *Stream) Subscribe(ctx context.Context, v interface{}) (*Subscriber, error) {
+	// processors receive one batch per shard, as they would from Lambda
+	_, perShard := v.(ddbstream.Processor)
+	return s.subscribe(ctx, perShard, func(streamARN string) invokeFunc {
+		return newInvoker(streamARN, v)
+	})
+}
+
+func (s *Stream) subscribe(ctx context.Context, perShard bool, invoker func(streamARN string) invokeFunc) (*Subscriber, error) {
+	if err := s.options.validate(); err != nil {
+		return nil, fmt.Errorf("unable to subscribe to table, %v: %w", s.tableName, err)
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 
 	describeInput := dynamodb.DescribeTableInput{
@@ -126,17 +213,30 @@ func (s *Stream) Subscribe(ctx context.Context, v interface{}) (*Subscriber, err
 	streamARN := aws.ToString(describeOutput.Table.LatestStreamArn)
 
 	subscriber := &Subscriber{
-		stream:  s,
-		cancel:  cancel,
-		done:    make(chan struct{}),
-		invoker: newInvoker(streamARN, v),
-		options: s.options,
+		stream:   s,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		drain:    make(chan struct{}),
+		invoker:  invoker(streamARN),
+		perShard: perShard,
+		options:  s.options,
 	}
 
+	skip, err := subscriber.startShards(ctx, streamARN)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("unable to subscribe to table, %v: %w", s.tableName, err)
+	}
+	subscriber.skip = skip
+
 	go func() {
 		defer close(subscriber.done)
 		defer cancel()
-		subscriber.err = subscriber.mainLoop(ctx, streamARN)
+
+		err := subscriber.mainLoop(ctx, streamARN)
+		if err != nil && !(errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+			subscriber.setErr(err)
+		}
 	}()
 
 	return subscriber, nil
@@ -159,8 +259,9 @@ func (s *Subscriber) getShards(ctx context.Context, streamARN string) ([]*types.
 			return nil, fmt.Errorf("unable to describe dynamodb stream, %v: %w", streamARN, err)
 		}
 
-		s.options.debug("found %v shards", len(output.StreamDescription.Shards))
+		s.options.logger.Debug("found shards", "streamARN", streamARN, "shards", len(output.StreamDescription.Shards))
 		for _, shard := range output.StreamDescription.Shards {
+			shard := shard
 			shards = append(shards, &shard)
 		}
 
@@ -173,29 +274,76 @@ func (s *Subscriber) getShards(ctx context.Context, streamARN string) ([]*types.
 	return shards, nil
 }
 
+// shardRecord associates a stream record with the shard it was read from.
+type shardRecord struct {
+	shardID string
+	record  *types.Record
+}
+
 func (s *Subscriber) mainLoop(ctx context.Context, streamARN string) (err error) {
 	var (
-		ch        = make(chan *types.Record)
+		ch        = make(chan *shardRecord)
 		next      = make(chan struct{}, 1)
 		wip       = &idSet{}
 		completed = &idSet{}
+		running   = &s.running
+		leases    = s.options.leases
 	)
+	completed.Add(s.skip...)
+
+	scanInterval := 30 * time.Second
+	if leases != nil {
+		if leases.duration < scanInterval {
+			scanInterval = leases.duration
+		}
+
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := leases.releaseAll(ctx, streamARN); err != nil {
+				s.options.logger.Warn("release leases failed", "streamARN", streamARN, "err", err)
+			}
+		}()
+	}
 
 	group, ctx := errgroup.WithContext(ctx)
+
+	// reading from the stream stops as soon as the subscriber drains, while
+	// delivery carries on until the records already read are processed
+	fetchCtx, stopFetch := context.WithCancel(ctx)
+	defer stopFetch()
+	go func() {
+		select {
+		case <-s.drain:
+			stopFetch()
+		case <-fetchCtx.Done():
+		}
+	}()
+	drained := make(chan struct{})
+
 	group.Go(func() error {
-		ticker := time.NewTicker(30 * time.Second)
+		ticker := time.NewTicker(scanInterval)
 		defer ticker.Stop()
 
 		expire := time.NewTicker(12 * time.Hour)
 		defer expire.Stop()
 
 		for {
-			s.options.debug("scanning for shards")
+			s.options.logger.Debug("scanning for shards", "streamARN", streamARN)
 
-			shards, err := s.getShards(ctx, streamARN)
-			if err != nil {
+			shards, err := s.getShards(fetchCtx, streamARN)
+			if err != nil && fetchCtx.Err() != nil {
+				// the subscriber is draining, which isn't a failure
+				return nil
+			}
+			if err != nil && s.options.errorPolicy == StopOnError {
 				return err
 			}
+			if err != nil {
+				s.options.onError(err)
+				shards = nil
+			}
 
 			excludeCompleted := func(shard *types.Shard) bool {
 				return !containsString(completed.Slice(), aws.ToString(shard.ShardId))
@@ -205,83 +353,183 @@ func (s *Subscriber) mainLoop(ctx context.Context, streamARN string) (err error)
 			d := dag{}
 			d.addShards(shards...)
 
-			for _, item := range d.Roots() {
+			roots := d.Roots()
+			if leases != nil {
+				roots = s.leaseShards(fetchCtx, streamARN, leases, roots, completed, running, next)
+			}
+
+			for _, item := range roots {
 				shard := item
 				shardID := aws.ToString(shard.ShardId)
 				if wip.Contains(shardID) {
 					continue
 				}
 
+				shardCtx, cancel := context.WithCancel(fetchCtx)
+				running.Add(shardID, cancel)
 				wip.AddAll(shard)
+				s.options.metrics.ActiveShards(wip.Size())
 				go func() {
-					defer wip.Remove(shardID)
-					defer completed.AddAll(shard)
+					defer func() {
+						wip.Remove(shardID)
+						s.options.metrics.ActiveShards(wip.Size())
+						s.options.metrics.ShardStopped(shardID)
+					}()
+					defer running.Cancel(shardID)
+					defer func() {
+						// unless the subscriber is draining, a shard that was stopped
+						// before its records completed is read again from its checkpoint
+						if shardCtx.Err() != nil && fetchCtx.Err() == nil {
+							s.progress.reset(shardID)
+						}
+					}()
 
 					select {
 					case next <- struct{}{}:
 					default:
 					}
 
-					s.options.debug("shard started, %v\n", shardID)
-					defer s.options.debug("shard completed, %v\n", shardID)
+					s.options.logger.Debug("shard started", "streamARN", streamARN, "shardID", shardID)
 
-					err := s.iterateShardWithRetry(ctx, streamARN, shard, ch)
+					err := s.iterateShardWithRetry(shardCtx, streamARN, shard, ch)
+					if shardCtx.Err() != nil {
+						s.options.logger.Debug("shard stopped", "streamARN", streamARN, "shardID", shardID)
+						return
+					}
+
+					// a failed shard is not completed; unless the subscriber stops,
+					// it is retried from its checkpoint on the next scan
 					if err != nil {
-						s.options.debug("iterate shard failed, %v", err)
+						err = &ShardError{ShardID: shardID, Err: err}
+						s.options.logger.Error("iterate shard failed", "streamARN", streamARN, "shardID", shardID, "err", err)
+						if leases != nil {
+							if err := leases.release(ctx, streamARN, shardID); err != nil {
+								s.options.onError(err)
+							}
+						}
+						s.fail(err)
+						return
+					}
+
+					// the shard is completed once all of its records are, so that its
+					// children aren't read before them and they aren't skipped if the
+					// process stops in the meantime
+					if err := s.progress.wait(shardCtx, shardID); err != nil {
+						s.options.logger.Debug("shard stopped", "streamARN", streamARN, "shardID", shardID)
+						return
+					}
+
+					completed.AddAll(shard)
+					s.options.metrics.ShardCompleted(shardID)
+					s.options.logger.Debug("shard completed", "streamARN", streamARN, "shardID", shardID)
+
+					if leases != nil {
+						if err := leases.complete(ctx, streamARN, shardID); err != nil {
+							s.options.onError(err)
+						}
+					}
+
+					// scan again so the shard's children start without waiting
+					// for the ticker
+					select {
+					case next <- struct{}{}:
+					default:
 					}
 				}()
 			}
 
 			select {
-			case <-ctx.Done():
+			case <-fetchCtx.Done():
 				return nil
 			case <-next:
 				continue
 
 			case <-expire.C:
 				n := completed.Expire(36 * time.Hour)
-				s.options.debug("expired %v elements", n)
+				s.options.logger.Debug("expired completed shards", "streamARN", streamARN, "shards", n)
 
 			case <-ticker.C:
 				continue
 			}
 		}
 	})
-	group.Go(func() error {
-		ticker := time.NewTicker(s.options.maxBatchWait)
-		defer ticker.Stop()
+	if leases != nil {
+		group.Go(func() error {
+			ticker := time.NewTicker(leases.duration / 3)
+			defer ticker.Stop()
 
-		var records []*types.Record
-		invoke := func() error {
-			if len(records) == 0 {
-				return nil
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-drained:
+					return nil
+
+				case <-ticker.C:
+					lost, err := leases.renew(ctx, streamARN)
+					if err != nil {
+						s.options.logger.Warn("renew leases failed", "streamARN", streamARN, "err", err)
+						s.options.onError(err)
+					}
+					for _, shardID := range lost {
+						s.options.logger.Info("lease lost", "streamARN", streamARN, "shardID", shardID)
+						running.Cancel(shardID)
+					}
+				}
 			}
+		})
+	}
+	group.Go(func() error {
+		defer close(drained)
+		return s.deliver(ctx, streamARN, ch)
+	})
+	return group.Wait()
+}
+
+// deliver batches the records read from ch and hands them to the callback.
+// Once the subscriber starts draining, records already read are flushed and
+// deliver returns when the callback has processed them.
+func (s *Subscriber) deliver(ctx context.Context, streamARN string, ch <-chan *shardRecord) error {
+	group, ctx := errgroup.WithContext(ctx)
 
-			c := 0
+	workers := make([]chan []*shardRecord, s.options.parallelism)
+	for i := range workers {
+		work := make(chan []*shardRecord, 1)
+		workers[i] = work
+		group.Go(func() error {
 			for {
-				if err := s.invoker(ctx, records); err != nil {
-					c += 1
-					if c > s.options.retryCount {
-						s.options.debug("callback failed, giving up after %d attempts", c)
-						records = nil
+				select {
+				case <-ctx.Done():
+					return nil
+
+				case records, ok := <-work:
+					if !ok {
 						return nil
 					}
-
-					delay := 3 * time.Second
-					s.options.debug("callback failed, retry: %d in %s %v ", err, c, delay)
-
-					select {
-					case <-ctx.Done():
-						return ctx.Err()
-					case <-time.After(delay):
-						continue
+					if err := s.invoke(ctx, streamARN, records); err != nil {
+						return err
 					}
 				}
-				break
 			}
+		})
+	}
+	group.Go(func() error {
+		ticker := time.NewTicker(s.options.maxBatchWait)
+		defer ticker.Stop()
 
-			records = nil
-			return nil
+		// records are partitioned by key so that records sharing a key are
+		// delivered by the same worker, in the order they were read
+		batches := make([][]*shardRecord, len(workers))
+		flush := func(i int) {
+			if len(batches[i]) == 0 {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+			case workers[i] <- batches[i]:
+			}
+			batches[i] = nil
 		}
 
 		for {
@@ -289,17 +537,24 @@ func (s *Subscriber) mainLoop(ctx context.Context, streamARN string) (err error)
 			case <-ctx.Done():
 				return nil
 
+			case <-s.drain:
+				s.options.logger.Debug("draining", "streamARN", streamARN)
+				for i := range batches {
+					flush(i)
+					close(workers[i])
+				}
+				return nil
+
 			case v := <-ch:
-				records = append(records, v)
-				if len(records) >= s.stream.options.batchSize {
-					if err := invoke(); err != nil {
-						return err
-					}
+				i := partition(v.record, len(workers))
+				batches[i] = append(batches[i], v)
+				if len(batches[i]) >= s.options.batchSize {
+					flush(i)
 				}
 
 			case <-ticker.C:
-				if err := invoke(); err != nil {
-					return err
+				for i := range batches {
+					flush(i)
 				}
 			}
 		}
@@ -307,6 +562,48 @@ func (s *Subscriber) mainLoop(ctx context.Context, streamARN string) (err error)
 	return group.Wait()
 }
 
+// leaseShards syncs leases for the available shards and returns the subset owned
+// by this worker. Shards no longer owned are stopped, and shards completed by
+// other workers are recorded so that their children become available.
+func (s *Subscriber) leaseShards(ctx context.Context, streamARN string, leases *LeaseManager, shards []*types.Shard, completed *idSet, running *cancelSet, next chan struct{}) []*types.Shard {
+	var shardIDs []string
+	for _, shard := range shards {
+		shardIDs = append(shardIDs, aws.ToString(shard.ShardId))
+	}
+
+	owned, done, err := leases.sync(ctx, streamARN, shardIDs)
+	if err != nil {
+		s.options.logger.Warn("sync leases failed", "streamARN", streamARN, "err", err)
+		s.options.onError(err)
+		return nil
+	}
+
+	for _, shardID := range running.Slice() {
+		if !containsString(owned, shardID) {
+			s.options.logger.Info("lease lost", "streamARN", streamARN, "shardID", shardID)
+			running.Cancel(shardID)
+		}
+	}
+
+	var found bool
+	for _, shardID := range done {
+		if containsString(shardIDs, shardID) {
+			completed.Add(shardID)
+			found = true
+		}
+	}
+	if found {
+		select {
+		case next <- struct{}{}:
+		default:
+		}
+	}
+
+	return filter(shards, func(shard *types.Shard) bool {
+		return containsString(owned, aws.ToString(shard.ShardId))
+	})
+}
+
 func filter(shards []*types.Shard, conditions ...func(shard *types.Shard) bool) (ss []*types.Shard) {
 loop:
 	for _, shard := range shards {
@@ -320,45 +617,321 @@ loop:
 	return ss
 }
 
-func (s *Subscriber) iterateShardWithRetry(ctx context.Context, streamARN string, shard *types.Shard, ch chan *types.Record) error {
-	var sequenceNumber *string
-	var multiplier time.Duration = 1
-	for {
-		if multiplier > 16 {
-			multiplier = 16
+// invoke delivers records to the callback, retrying failures according to the
+// retry policy and checkpointing records as they complete.
+func (s *Subscriber) invoke(ctx context.Context, streamARN string, records []*shardRecord) error {
+	c := 0
+	started := time.Now()
+	for len(records) > 0 {
+		invoked := time.Now()
+		response, err := s.call(ctx, streamARN, records)
+		succeeded, failed := []*shardRecord(nil), records
+		if err == nil {
+			succeeded, failed = splitFailures(records, response)
+			if len(failed) > 0 {
+				err = fmt.Errorf("%v of %v records failed", len(failed), len(records))
+			}
+		}
+		s.options.metrics.Batch(len(records), time.Since(invoked), err)
+		s.checkpoint(ctx, streamARN, succeeded)
+		if len(failed) == 0 {
+			break
 		}
 
-		if err := s.iterateShard(ctx, streamARN, shard, ch, sequenceNumber); err != nil {
-			var ae *types.LimitExceededException
-			if errors.As(err, &ae) {
-				multiplier *= 2
-				delay := time.Second * multiplier
-				s.options.debug("rate limit exceeded, pausing %v", delay)
+		// only the failed records, and those after them in the same shard, are retried
+		records = failed
+		c += 1
+		delay, ok := s.options.retryPolicy.NextDelay(c, time.Since(started), err)
+		if !ok {
+			s.options.logger.Error("callback failed, giving up", "streamARN", streamARN, "records", len(records), "attempt", c, "err", err)
+			s.options.metrics.GiveUp(len(records))
+			if err := s.deadLetter(ctx, streamARN, records, err, c); err != nil {
+				// the records were neither handled nor dead lettered, so their
+				// shards are read again from the checkpoint they hold back
+				s.restart(records)
+				s.fail(err)
+				return nil
+			}
+			s.checkpoint(ctx, streamARN, records)
+			break
+		}
 
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.After(delay):
-					continue
-				}
+		s.options.logger.Warn("callback failed, retrying", "streamARN", streamARN, "records", len(records), "attempt", c, "delay", delay, "err", err)
+		s.options.metrics.Retry()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			continue
+		}
+	}
+
+	return nil
+}
+
+// restart stops the shards of records, forgetting the records in flight, so
+// that they're read again from their checkpoint on the next scan.
+func (s *Subscriber) restart(records []*shardRecord) {
+	for _, r := range records {
+		s.running.Cancel(r.shardID)
+		s.progress.reset(r.shardID)
+	}
+}
+
+// call invokes the callback with records, with the metadata of the batch in
+// the context. When the callback expects batches from a single shard, records
+// are split per shard.
+func (s *Subscriber) call(ctx context.Context, streamARN string, records []*shardRecord) (events.DynamoDBEventResponse, error) {
+	ctx = ddbstream.NewContext(ctx, ddbstream.Metadata{StreamARN: streamARN})
+	if !s.perShard {
+		batch := make([]*types.Record, 0, len(records))
+		for _, r := range records {
+			batch = append(batch, r.record)
+		}
+		return s.invoker(ctx, batch)
+	}
+
+	var (
+		batches []*routeBatch
+		byShard = map[string]*routeBatch{}
+	)
+	for _, r := range records {
+		batch, ok := byShard[r.shardID]
+		if !ok {
+			md := ddbstream.Metadata{StreamARN: streamARN, ShardID: r.shardID}
+			batch = &routeBatch{
+				invoke: func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+					return s.invoker(ddbstream.NewContext(ctx, md), records)
+				},
 			}
-			return err
+			byShard[r.shardID] = batch
+			batches = append(batches, batch)
 		}
+		batch.records = append(batch.records, r.record)
+	}
+	return invokeAll(ctx, batches)
+}
+
+// partition assigns the record to one of n workers by its PK, or by all of its
+// keys when it has no PK.
+func partition(record *types.Record, n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	var keys map[string]types.AttributeValue
+	if record.Dynamodb != nil {
+		keys = record.Dynamodb.Keys
+	}
+
+	names := []string{"PK"}
+	if _, ok := keys["PK"]; !ok {
+		names = names[:0]
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	h := fnv.New32a()
+	for _, name := range names {
+		h.Write([]byte(name))
+		switch v := keys[name].(type) {
+		case *types.AttributeValueMemberS:
+			h.Write([]byte(v.Value))
+		case *types.AttributeValueMemberN:
+			h.Write([]byte(v.Value))
+		case *types.AttributeValueMemberB:
+			h.Write(v.Value)
+		}
+	}
+	return int(h.Sum32() % uint32(n))
+}
+
+// splitFailures separates the records that succeeded from those to retry given
+// the batch item failures reported by the handler. For each shard, the first
+// failed record and every record after it are retried. As with Lambda, an
+// unknown item identifier fails the whole batch.
+func splitFailures(records []*shardRecord, response events.DynamoDBEventResponse) (succeeded, failed []*shardRecord) {
+	if len(response.BatchItemFailures) == 0 {
+		return records, nil
+	}
+
+	positions := map[string]int{}
+	for i, r := range records {
+		positions[aws.ToString(r.record.Dynamodb.SequenceNumber)] = i
+	}
+
+	firstFailure := map[string]int{}
+	for _, failure := range response.BatchItemFailures {
+		i, ok := positions[failure.ItemIdentifier]
+		if !ok {
+			return nil, records
+		}
+
+		shardID := records[i].shardID
+		if first, ok := firstFailure[shardID]; !ok || i < first {
+			firstFailure[shardID] = i
+		}
+	}
+
+	for i, r := range records {
+		if first, ok := firstFailure[r.shardID]; ok && i >= first {
+			failed = append(failed, r)
+		} else {
+			succeeded = append(succeeded, r)
+		}
+	}
+	return succeeded, failed
+}
+
+// deadLetter sends the records to the dead letter sink, one dead letter per
+// shard.
+func (s *Subscriber) deadLetter(ctx context.Context, streamARN string, records []*shardRecord, err error, attempts int) error {
+	sink := s.options.deadLetter
+	if sink == nil {
 		return nil
 	}
+
+	var (
+		shardIDs []string
+		byShard  = map[string][]*types.Record{}
+	)
+	for _, r := range records {
+		if _, ok := byShard[r.shardID]; !ok {
+			shardIDs = append(shardIDs, r.shardID)
+		}
+		byShard[r.shardID] = append(byShard[r.shardID], r.record)
+	}
+
+	var errs []error
+	for _, shardID := range shardIDs {
+		letter := DeadLetter{
+			StreamARN: streamARN,
+			ShardID:   shardID,
+			Records:   byShard[shardID],
+			Err:       err,
+			Attempts:  attempts,
+		}
+		if err := sink.Send(ctx, letter); err != nil {
+			s.options.logger.Error("dead letter failed", "streamARN", streamARN, "shardID", shardID, "err", err)
+			errs = append(errs, fmt.Errorf("unable to send dead letter for shard, %v: %w", shardID, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func (s *Subscriber) iterateShard(ctx context.Context, streamARN string, shard *types.Shard, ch chan *types.Record, sequenceNumber *string) error {
-	iteratorType := s.options.shardIteratorType
-	if sequenceNumber != nil {
-		iteratorType = string(types.ShardIteratorTypeAfterSequenceNumber)
+// checkpoint marks records as processed and records, for each shard, the
+// last sequence number before which every record has been processed.
+func (s *Subscriber) checkpoint(ctx context.Context, streamARN string, records []*shardRecord) {
+	for shardID, sequenceNumber := range s.progress.complete(records) {
+		if err := s.options.checkpoints.SetCheckpoint(ctx, streamARN, shardID, sequenceNumber); err != nil {
+			s.options.logger.Warn("checkpoint failed", "streamARN", streamARN, "shardID", shardID, "sequenceNumber", sequenceNumber, "err", err)
+			s.options.onError(err)
+		}
+	}
+}
+
+// shardPosition is how far a shard has been read, so that a retry resumes
+// where the previous attempt left off.
+type shardPosition struct {
+	// sequenceNumber is the last record read, if any.
+	sequenceNumber *string
+
+	// since is when the shard was first read from LATEST. A retry before any
+	// record was read can't re-acquire LATEST without missing the records
+	// written in the meantime, so it reads from TRIM_HORIZON instead and skips
+	// the records created more than latestMargin before since.
+	since time.Time
+}
+
+// latestMargin allows for ApproximateCreationDateTime being approximate when
+// a shard read from LATEST is read again from TRIM_HORIZON. Records written
+// shortly before the shard was first read may be delivered.
+const latestMargin = time.Minute
+
+func (s *Subscriber) iterateShardWithRetry(ctx context.Context, streamARN string, shard *types.Shard, ch chan *shardRecord) error {
+	var position shardPosition
+	checkpoint, err := s.options.checkpoints.GetCheckpoint(ctx, streamARN, aws.ToString(shard.ShardId))
+	if err != nil {
+		return err
+	}
+	if checkpoint != "" {
+		s.options.logger.Info("resuming shard", "streamARN", streamARN, "shardID", aws.ToString(shard.ShardId), "sequenceNumber", checkpoint)
+		position.sequenceNumber = aws.String(checkpoint)
+	}
+
+	var (
+		retries int
+		started = time.Now()
+	)
+	for {
+		last := aws.ToString(position.sequenceNumber)
+		err := s.iterateShard(ctx, streamARN, shard, ch, &position)
+		if err == nil {
+			return nil
+		}
+
+		// a shard that made progress since the last failure starts afresh
+		if aws.ToString(position.sequenceNumber) != last {
+			retries, started = 0, time.Now()
+		}
+
+		// the iterator is re-acquired after the last sequence number read, which
+		// also recovers from expired iterators
+		retries++
+		delay, ok := s.options.shardRetryPolicy.NextDelay(retries, time.Since(started), err)
+		if !ok {
+			return err
+		}
+		s.options.logger.Warn("iterate shard failed, retrying", "streamARN", streamARN, "shardID", aws.ToString(shard.ShardId), "sequenceNumber", aws.ToString(position.sequenceNumber), "attempt", retries, "delay", delay, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			continue
+		}
+	}
+}
+
+// iterateShard reads records from the shard and publishes them to ch. position
+// is advanced as records are read so that a retry resumes after the last one.
+func (s *Subscriber) iterateShard(ctx context.Context, streamARN string, shard *types.Shard, ch chan *shardRecord, position *shardPosition) error {
+	shardID := aws.ToString(shard.ShardId)
+	iteratorType, startSequenceNumber := s.options.start.iterator(shardID)
+
+	var skipBefore time.Time
+	switch {
+	case position.sequenceNumber != nil:
+		iteratorType, startSequenceNumber = types.ShardIteratorTypeAfterSequenceNumber, position.sequenceNumber
+	case iteratorType == types.ShardIteratorTypeLatest && !position.since.IsZero():
+		iteratorType, skipBefore = types.ShardIteratorTypeTrimHorizon, position.since.Add(-latestMargin)
+	case iteratorType == types.ShardIteratorTypeLatest:
+		position.since = time.Now()
+	}
+
+	// skipped is the last record skipped while no earlier record was in
+	// flight. It's checkpointed at the end of the page, or before the next
+	// record is handed over so the checkpoint never moves back.
+	var skipped *string
+	checkpointSkipped := func() {
+		if skipped == nil {
+			return
+		}
+		if err := s.options.checkpoints.SetCheckpoint(ctx, streamARN, shardID, *skipped); err != nil {
+			s.options.logger.Warn("checkpoint failed", "streamARN", streamARN, "shardID", shardID, "sequenceNumber", *skipped, "err", err)
+			s.options.onError(err)
+		}
+		skipped = nil
 	}
 
 	for {
 		iterInput := dynamodbstreams.GetShardIteratorInput{
-			SequenceNumber:    sequenceNumber,
+			SequenceNumber:    startSequenceNumber,
 			ShardId:           shard.ShardId,
-			ShardIteratorType: types.ShardIteratorType(iteratorType),
+			ShardIteratorType: iteratorType,
 			StreamArn:         aws.String(streamARN),
 		}
 		iterOutput, err := s.stream.streamAPI.GetShardIterator(ctx, &iterInput)
@@ -377,14 +950,37 @@ func (s *Subscriber) iterateShard(ctx context.Context, streamARN string, shard *
 				return fmt.Errorf("failed to get records from shard, %v: %w", aws.ToString(iterOutput.ShardIterator), err)
 			}
 
+			var age time.Duration
+			if n := len(output.Records); n > 0 {
+				if created := output.Records[n-1].Dynamodb.ApproximateCreationDateTime; created != nil {
+					age = time.Since(*created)
+				}
+			}
+			s.options.metrics.IteratorAge(shardID, age)
+
 			for _, record := range output.Records {
+				record := record
+				r := &shardRecord{shardID: shardID, record: &record}
+				if s.options.start.skip(&record) || createdBefore(&record, skipBefore) || !s.options.filters.accept(streamARN, &record) {
+					position.sequenceNumber = record.Dynamodb.SequenceNumber
+					if s.progress.skip(r) {
+						skipped = record.Dynamodb.SequenceNumber
+					}
+					continue
+				}
+
+				// records are tracked before they're handed over, so the shard
+				// can't be completed while they're still in flight
+				checkpointSkipped()
+				s.progress.add(r)
 				select {
 				case <-ctx.Done():
 					return nil
-				case ch <- &record:
-					// ok
+				case ch <- r:
+					position.sequenceNumber = record.Dynamodb.SequenceNumber
 				}
 			}
+			checkpointSkipped()
 
 			iterator = output.NextShardIterator
 			if iterator == nil {
@@ -403,8 +999,66 @@ func (s *Subscriber) iterateShard(ctx context.Context, streamARN string, shard *
 	}
 }
 
+// fail reports err and, unless the error policy is ContinueOnError, stops the
+// subscriber with err. Returns true if the subscriber is stopping.
+func (s *Subscriber) fail(err error) bool {
+	s.options.onError(err)
+	if s.options.errorPolicy == ContinueOnError {
+		return false
+	}
+
+	s.setErr(err)
+	s.cancel()
+	return true
+}
+
+func (s *Subscriber) setErr(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Err returns the error that stopped the subscriber, if any.
+func (s *Subscriber) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+// Done returns a channel that is closed once the subscriber has stopped,
+// either because it was closed or because of a fatal error reported by Err.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops the subscriber immediately, abandoning any batch in flight, and
+// returns the error that stopped it, if any. Use Shutdown to drain first.
 func (s *Subscriber) Close() error {
 	s.cancel()
 	<-s.done
-	return s.err
+	return s.Err()
+}
+
+// Shutdown stops reading from the stream, delivers the records already read
+// to the callback and waits for in-flight invocations to complete before
+// stopping the subscriber. If ctx is done first, Shutdown stops the subscriber
+// as Close would and returns the context error.
+//
+// Records that were not delivered are not checkpointed and are read again
+// when the subscriber restarts.
+func (s *Subscriber) Shutdown(ctx context.Context) error {
+	s.draining.Do(func() { close(s.drain) })
+
+	select {
+	case <-s.done:
+		return s.Err()
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,781 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+)
+
+func sequenceNumbers(records []*shardRecord) (ss []string) {
+	for _, r := range records {
+		ss = append(ss, *r.record.Dynamodb.SequenceNumber)
+	}
+	return ss
+}
+
+func Test_splitFailures(t *testing.T) {
+	records := []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "B", record: newRecord("2")},
+		{shardID: "A", record: newRecord("3")},
+		{shardID: "B", record: newRecord("4")},
+		{shardID: "A", record: newRecord("5")},
+	}
+
+	testCases := map[string]struct {
+		Failures      []string
+		WantSucceeded []string
+		WantFailed    []string
+	}{
+		"no failures": {
+			WantSucceeded: []string{"1", "2", "3", "4", "5"},
+		},
+		"retries remainder of shard": {
+			Failures:      []string{"3"},
+			WantSucceeded: []string{"1", "2", "4"},
+			WantFailed:    []string{"3", "5"},
+		},
+		"earliest failure per shard": {
+			Failures:      []string{"5", "1", "4"},
+			WantSucceeded: []string{"2"},
+			WantFailed:    []string{"1", "3", "4", "5"},
+		},
+		"unknown identifier fails batch": {
+			Failures:   []string{"9"},
+			WantFailed: []string{"1", "2", "3", "4", "5"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var response events.DynamoDBEventResponse
+			for _, id := range tc.Failures {
+				response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: id})
+			}
+
+			succeeded, failed := splitFailures(records, response)
+			if got := sequenceNumbers(succeeded); !reflect.DeepEqual(got, tc.WantSucceeded) {
+				t.Fatalf("got %v; want %v", got, tc.WantSucceeded)
+			}
+			if got := sequenceNumbers(failed); !reflect.DeepEqual(got, tc.WantFailed) {
+				t.Fatalf("got %v; want %v", got, tc.WantFailed)
+			}
+		})
+	}
+}
+
+func Test_partition(t *testing.T) {
+	newKeyedRecord := func(pk, sk string) *types.Record {
+		return &types.Record{
+			Dynamodb: &types.StreamRecord{
+				Keys: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: pk},
+					"SK": &types.AttributeValueMemberS{Value: sk},
+				},
+			},
+		}
+	}
+
+	seen := map[int]struct{}{}
+	for i := 0; i < 100; i++ {
+		pk := fmt.Sprintf("User#%v", i)
+		got := partition(newKeyedRecord(pk, "a"), 4)
+		if want := partition(newKeyedRecord(pk, "b"), 4); got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		seen[got] = struct{}{}
+	}
+	if got, want := len(seen), 4; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_invoke(t *testing.T) {
+	ctx := context.Background()
+	records := []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "A", record: newRecord("2")},
+		{shardID: "B", record: newRecord("3")},
+	}
+
+	var (
+		calls       [][]string
+		ch          = make(chan DeadLetter, 1)
+		checkpoints = NewMemoryCheckpointStore()
+	)
+	subscriber := &Subscriber{
+		invoker: func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			var call []string
+			for _, r := range records {
+				call = append(call, *r.Dynamodb.SequenceNumber)
+			}
+			calls = append(calls, call)
+			return events.DynamoDBEventResponse{
+				BatchItemFailures: []events.DynamoDBBatchItemFailure{{ItemIdentifier: "2"}},
+			}, nil
+		},
+		options: buildOptions(
+			WithCheckpointStore(checkpoints),
+			WithDeadLetter(NewChannelDeadLetterSink(ch)),
+			WithRetryPolicy(ExponentialBackoff{MaxRetries: 1}),
+		),
+	}
+	for _, r := range records {
+		subscriber.progress.add(r)
+	}
+
+	if err := subscriber.invoke(ctx, "arn", records); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	if want := [][]string{{"1", "2", "3"}, {"2"}}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("got %v; want %v", calls, want)
+	}
+	if got := sequenceNumbers(shardRecords((<-ch).Records)); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Fatalf("got %v; want [2]", got)
+	}
+	for shardID, want := range map[string]string{"A": "2", "B": "3"} {
+		if got, _ := checkpoints.GetCheckpoint(ctx, "arn", shardID); got != want {
+			t.Fatalf("shard %v: got %v; want %v", shardID, got, want)
+		}
+	}
+}
+
+type failingSink struct{}
+
+func (failingSink) Send(context.Context, DeadLetter) error {
+	return errors.New("sink unavailable")
+}
+
+func Test_invoke_deadLetterFailed(t *testing.T) {
+	ctx := context.Background()
+	records := []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "A", record: newRecord("2")},
+	}
+
+	var reported []error
+	checkpoints := NewMemoryCheckpointStore()
+	subscriber := &Subscriber{
+		invoker: func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			return events.DynamoDBEventResponse{
+				BatchItemFailures: []events.DynamoDBBatchItemFailure{{ItemIdentifier: "2"}},
+			}, nil
+		},
+		options: buildOptions(
+			WithCheckpointStore(checkpoints),
+			WithDeadLetter(failingSink{}),
+			WithRetryPolicy(ExponentialBackoff{MaxRetries: 1}),
+			WithErrorPolicy(ContinueOnError),
+			WithErrorHandler(func(err error) { reported = append(reported, err) }),
+		),
+	}
+	for _, r := range records {
+		subscriber.progress.add(r)
+	}
+	later := &shardRecord{shardID: "A", record: newRecord("3")}
+	subscriber.progress.add(later)
+
+	shardCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	subscriber.running.Add("A", cancel)
+
+	if err := subscriber.invoke(ctx, "arn", records); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	// the record that succeeded is checkpointed, the one that was lost isn't
+	if got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A"); got != "1" {
+		t.Fatalf("got %v; want 1", got)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("got %v; want one error", reported)
+	}
+
+	// the shard is stopped to be read again from its checkpoint, and records
+	// of the previous read no longer hold it back
+	if shardCtx.Err() == nil {
+		t.Fatalf("got shard running; want stopped")
+	}
+	subscriber.checkpoint(ctx, "arn", []*shardRecord{later})
+	if got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A"); got != "1" {
+		t.Fatalf("got %v; want 1", got)
+	}
+	if len(subscriber.progress.pending) != 0 || len(subscriber.progress.done) != 0 {
+		t.Fatalf("got %v pending, %v done; want none", len(subscriber.progress.pending), len(subscriber.progress.done))
+	}
+}
+
+func shardRecords(records []*types.Record) (rr []*shardRecord) {
+	for _, r := range records {
+		rr = append(rr, &shardRecord{record: r})
+	}
+	return rr
+}
+
+func Test_fail(t *testing.T) {
+	want := &ShardError{ShardID: "A", Err: io.EOF}
+
+	t.Run("stop on error", func(t *testing.T) {
+		var reported []error
+		ctx, cancel := context.WithCancel(context.Background())
+		subscriber := &Subscriber{
+			cancel:  cancel,
+			options: buildOptions(WithErrorHandler(func(err error) { reported = append(reported, err) })),
+		}
+
+		if !subscriber.fail(want) {
+			t.Fatalf("got false; want true")
+		}
+		subscriber.fail(io.ErrUnexpectedEOF)
+
+		if got := subscriber.Err(); !errors.Is(got, io.EOF) {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+		if ctx.Err() == nil {
+			t.Fatalf("got nil; want context cancelled")
+		}
+		if got, want := len(reported), 2; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		var reported []error
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		subscriber := &Subscriber{
+			cancel: cancel,
+			options: buildOptions(
+				WithErrorPolicy(ContinueOnError),
+				WithErrorHandler(func(err error) { reported = append(reported, err) }),
+			),
+		}
+
+		if subscriber.fail(want) {
+			t.Fatalf("got true; want false")
+		}
+		if got := subscriber.Err(); got != nil {
+			t.Fatalf("got %v; want nil", got)
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("got %v; want nil", ctx.Err())
+		}
+		if got, want := len(reported), 1; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+	})
+}
+
+func Test_deliver_drain(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mutex sync.Mutex
+		got   []string
+	)
+	subscriber := &Subscriber{
+		drain: make(chan struct{}),
+		invoker: func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			for _, r := range records {
+				got = append(got, *r.Dynamodb.SequenceNumber)
+			}
+			return events.DynamoDBEventResponse{}, nil
+		},
+		options: buildOptions(
+			WithBatchSize(100),
+			WithMaxBatchWait(time.Hour),
+			WithParallelism(2),
+		),
+	}
+
+	ch := make(chan *shardRecord)
+	done := make(chan error, 1)
+	go func() {
+		done <- subscriber.deliver(ctx, "arn", ch)
+	}()
+
+	for _, seq := range []string{"1", "2", "3"} {
+		ch <- &shardRecord{shardID: "A", record: newRecord(seq)}
+	}
+	close(subscriber.drain)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got timeout; want drained")
+	}
+
+	sort.Strings(got)
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_Shutdown_deadline(t *testing.T) {
+	done := make(chan struct{})
+	subscriber := &Subscriber{
+		cancel: func() { close(done) },
+		done:   done,
+		drain:  make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := subscriber.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_call_processor(t *testing.T) {
+	ctx := context.Background()
+	records := []*shardRecord{
+		{shardID: "A", record: newRecord("1")},
+		{shardID: "B", record: newRecord("2")},
+		{shardID: "A", record: newRecord("3")},
+	}
+
+	var got []ddbstream.Batch
+	processor := ddbstream.ProcessorFunc(func(ctx context.Context, batch ddbstream.Batch) (events.DynamoDBEventResponse, error) {
+		if md, _ := ddbstream.FromContext(ctx); md != batch.Metadata {
+			t.Fatalf("got %v; want %v", md, batch.Metadata)
+		}
+		got = append(got, batch)
+		if batch.ShardID == "B" {
+			return events.DynamoDBEventResponse{}, errors.New("boom")
+		}
+		return events.DynamoDBEventResponse{}, nil
+	})
+	subscriber := &Subscriber{
+		invoker:  newInvoker("arn", processor),
+		perShard: true,
+	}
+
+	response, err := subscriber.call(ctx, "arn", records)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	want := []ddbstream.Batch{
+		{Metadata: ddbstream.Metadata{StreamARN: "arn", ShardID: "A"}, Records: []*types.Record{records[0].record, records[2].record}},
+		{Metadata: ddbstream.Metadata{StreamARN: "arn", ShardID: "B"}, Records: []*types.Record{records[1].record}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if want := []events.DynamoDBBatchItemFailure{{ItemIdentifier: "2"}}; !reflect.DeepEqual(response.BatchItemFailures, want) {
+		t.Fatalf("got %v; want %v", response.BatchItemFailures, want)
+	}
+}
+
+func Test_Subscriber_completesLeaseOnceCheckpointed(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestStream(t, &testShard{id: "A", records: testRecords("1", "2"), closed: true})
+
+	var (
+		received    = make(chan struct{})
+		release     = make(chan struct{})
+		store       = &memoryLeaseStore{}
+		checkpoints = NewMemoryCheckpointStore()
+	)
+	handler := func(ctx context.Context, records []*types.Record) error {
+		close(received)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	subscriber, err := ts.stream(
+		StartAtTrimHorizon(),
+		WithBatchSize(2),
+		WithCheckpointStore(checkpoints),
+		WithLeaseManager(NewLeaseManager(store, "w1", time.Minute)),
+	).Subscribe(ctx, handler)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer subscriber.Close()
+
+	completed := func() bool {
+		leases, _ := store.ListLeases(ctx, "arn")
+		return len(leases) == 1 && leases[0].Completed
+	}
+
+	// the shard has been read to the end, but its last batch is in flight
+	<-received
+	time.Sleep(50 * time.Millisecond)
+	if completed() {
+		t.Fatalf("got completed lease; want the shard in progress")
+	}
+
+	close(release)
+	waitFor(t, "completed lease", completed)
+	if got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A"); got != "2" {
+		t.Fatalf("got %v; want 2", got)
+	}
+}
+
+func Test_Subscriber_Shutdown_duringScan(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestStream(t, &testShard{id: "A", records: testRecords("1", "2")})
+
+	// the scan that follows the shard starting is still describing the stream
+	// when the subscriber drains
+	describing := make(chan struct{})
+	ts.onDescribe = func(r *http.Request, n int) {
+		if n == 2 {
+			close(describing)
+			<-r.Context().Done()
+		}
+	}
+
+	var (
+		received    = make(chan struct{})
+		release     = make(chan struct{})
+		checkpoints = NewMemoryCheckpointStore()
+	)
+	handler := func(ctx context.Context, records []*types.Record) error {
+		close(received)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	subscriber, err := ts.stream(
+		StartAtTrimHorizon(),
+		WithBatchSize(2),
+		WithCheckpointStore(checkpoints),
+	).Subscribe(ctx, handler)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer subscriber.Close()
+
+	<-received
+	<-describing
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- subscriber.Shutdown(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-shutdown; err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A"); got != "2" {
+		t.Fatalf("got %v; want 2", got)
+	}
+}
+
+// recorder is a callback recording the sequence numbers it receives.
+type recorder struct {
+	mutex sync.Mutex
+	got   []string
+}
+
+func (r *recorder) handle(ctx context.Context, records []*types.Record) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, record := range records {
+		r.got = append(r.got, *record.Dynamodb.SequenceNumber)
+	}
+	return nil
+}
+
+func (r *recorder) received() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.got...)
+}
+
+func Test_Subscriber_expiredIterator(t *testing.T) {
+	ctx := context.Background()
+	old := testRecord{sequenceNumber: "0", created: time.Now().Add(-time.Hour)}
+
+	testCases := map[string]struct {
+		start         Option
+		records       []testRecord
+		wantIterators []string
+		wantReceived  []string
+	}{
+		"after the last record read": {
+			start:         StartAtTrimHorizon(),
+			records:       testRecords("1", "2"),
+			wantIterators: []string{"A TRIM_HORIZON", "A AFTER_SEQUENCE_NUMBER 2"},
+			wantReceived:  []string{"1", "2", "3"},
+		},
+		// LATEST can't be acquired again without missing records, so the shard
+		// is read from TRIM_HORIZON, skipping records from before it was read
+		"latest before any record is read": {
+			start:         StartAtLatest(),
+			records:       []testRecord{old},
+			wantIterators: []string{"A LATEST", "A TRIM_HORIZON"},
+			wantReceived:  []string{"3"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			shard := &testShard{id: "A", records: tc.records}
+			ts := newTestStream(t, shard)
+
+			// the iterator expires once the records are read, while another
+			// record is written
+			var expired bool
+			ts.onGetRecords = func(shard *testShard, pos int) string {
+				if expired || pos < len(tc.records) {
+					return ""
+				}
+				expired = true
+				shard.records = append(shard.records, testRecords("3")...)
+				return "ExpiredIteratorException"
+			}
+
+			var r recorder
+			subscriber, err := ts.stream(
+				tc.start,
+				WithBatchSize(1),
+				WithPollInterval(time.Millisecond),
+				WithShardRetryPolicy(ExponentialBackoff{InitialInterval: time.Millisecond, Retryable: RetryableStreamError}),
+			).Subscribe(ctx, r.handle)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer subscriber.Close()
+
+			waitFor(t, fmt.Sprint(tc.wantReceived), func() bool {
+				return len(r.received()) == len(tc.wantReceived)
+			})
+			if got := r.received(); !reflect.DeepEqual(got, tc.wantReceived) {
+				t.Fatalf("got %v; want %v", got, tc.wantReceived)
+			}
+			if got := ts.requested(); !reflect.DeepEqual(got, tc.wantIterators) {
+				t.Fatalf("got %v; want %v", got, tc.wantIterators)
+			}
+		})
+	}
+}
+
+func Test_Subscriber_resumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	shard := &testShard{id: "A", records: testRecords("1", "2")}
+	ts := newTestStream(t, shard)
+	checkpoints := NewMemoryCheckpointStore()
+
+	var first recorder
+	subscriber, err := ts.stream(
+		StartAtTrimHorizon(),
+		WithPollInterval(time.Millisecond),
+		WithMaxBatchWait(time.Millisecond),
+		WithCheckpointStore(checkpoints),
+	).Subscribe(ctx, first.handle)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	waitFor(t, "checkpoint 2", func() bool {
+		got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A")
+		return got == "2"
+	})
+	if err := subscriber.Close(); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	// the restarted subscriber only receives records written since
+	ts.mutex.Lock()
+	shard.records = append(shard.records, testRecords("3")...)
+	ts.mutex.Unlock()
+
+	var second recorder
+	subscriber, err = ts.stream(
+		StartAtTrimHorizon(),
+		WithPollInterval(time.Millisecond),
+		WithMaxBatchWait(time.Millisecond),
+		WithCheckpointStore(checkpoints),
+	).Subscribe(ctx, second.handle)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer subscriber.Close()
+
+	waitFor(t, "record 3", func() bool { return len(second.received()) > 0 })
+	if got, want := second.received(), []string{"3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := ts.requested(), []string{"A TRIM_HORIZON", "A AFTER_SEQUENCE_NUMBER 2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func Test_Subscriber_startShards(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := map[string]struct {
+		start         Option
+		wantIterators []string
+		wantReceived  []string
+	}{
+		// the ancestors of a shard given to StartAt are never read
+		"start at": {
+			start:         StartAt(map[string]string{"C": "4"}),
+			wantIterators: []string{"C AT_SEQUENCE_NUMBER 4"},
+			wantReceived:  []string{"4"},
+		},
+		// parents are read to the end before their children
+		"trim horizon": {
+			start:         StartAtTrimHorizon(),
+			wantIterators: []string{"A TRIM_HORIZON", "B TRIM_HORIZON", "C TRIM_HORIZON"},
+			wantReceived:  []string{"0", "1", "2", "3", "4"},
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			ts := newTestStream(t,
+				&testShard{id: "A", records: testRecords("0"), closed: true},
+				&testShard{id: "B", parentID: "A", records: testRecords("1", "2"), closed: true},
+				&testShard{id: "C", parentID: "B", records: testRecords("3", "4")},
+			)
+
+			var r recorder
+			subscriber, err := ts.stream(
+				tc.start,
+				WithPollInterval(time.Millisecond),
+				WithMaxBatchWait(time.Millisecond),
+			).Subscribe(ctx, r.handle)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer subscriber.Close()
+
+			waitFor(t, fmt.Sprint(tc.wantReceived), func() bool {
+				return len(r.received()) == len(tc.wantReceived)
+			})
+			if got := r.received(); !reflect.DeepEqual(got, tc.wantReceived) {
+				t.Fatalf("got %v; want %v", got, tc.wantReceived)
+			}
+			if got := ts.requested(); !reflect.DeepEqual(got, tc.wantIterators) {
+				t.Fatalf("got %v; want %v", got, tc.wantIterators)
+			}
+		})
+	}
+}
+
+func Test_Subscriber_checkpointsFilteredRecords(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := map[string]struct {
+		pattern      string
+		wantReceived []string
+	}{
+		"between delivered records": {
+			pattern:      `{"dynamodb": {"Keys": {"PK": {"S": ["pk2"]}}}}`,
+			wantReceived: []string{"2"},
+		},
+		"none delivered": {
+			pattern: `{"dynamodb": {"Keys": {"PK": {"S": ["pk9"]}}}}`,
+		},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			ts := newTestStream(t, &testShard{id: "A", records: testRecords("1", "2", "3")})
+			checkpoints := NewMemoryCheckpointStore()
+
+			var r recorder
+			subscriber, err := ts.stream(
+				StartAtTrimHorizon(),
+				WithPollInterval(time.Millisecond),
+				WithMaxBatchWait(time.Millisecond),
+				WithCheckpointStore(checkpoints),
+				WithFilter(tc.pattern),
+			).Subscribe(ctx, r.handle)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer subscriber.Close()
+
+			// the shard is checkpointed past the last record, although it was
+			// never delivered
+			waitFor(t, "checkpoint 3", func() bool {
+				got, _ := checkpoints.GetCheckpoint(ctx, "arn", "A")
+				return got == "3"
+			})
+			if got := r.received(); !reflect.DeepEqual(got, tc.wantReceived) {
+				t.Fatalf("got %v; want %v", got, tc.wantReceived)
+			}
+		})
+	}
+}
+
+func Test_Subscriber_removesIteratorAgeOfStoppedShards(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestStream(t, &testShard{id: "A", records: testRecords("1")})
+
+	// the shard fails once its records are read
+	ts.onGetRecords = func(shard *testShard, pos int) string {
+		if pos < len(shard.records) {
+			return ""
+		}
+		return "ValidationException"
+	}
+
+	var (
+		metrics = NewMemoryMetrics()
+		failed  = make(chan error, 1)
+		r       recorder
+	)
+	subscriber, err := ts.stream(
+		StartAtTrimHorizon(),
+		WithMetrics(metrics),
+		WithErrorPolicy(ContinueOnError),
+		WithErrorHandler(func(err error) {
+			select {
+			case failed <- err:
+			default:
+			}
+		}),
+		WithShardRetryPolicy(ExponentialBackoff{Retryable: func(error) bool { return false }}),
+	).Subscribe(ctx, r.handle)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer subscriber.Close()
+
+	var shardErr *ShardError
+	if err := <-failed; !errors.As(err, &shardErr) {
+		t.Fatalf("got %v; want *ShardError", err)
+	}
+	waitFor(t, "iterator age removed", func() bool {
+		var buf bytes.Buffer
+		metrics.WriteTo(&buf)
+		return !strings.Contains(buf.String(), `shard="A"`)
+	})
+}
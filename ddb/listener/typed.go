@@ -0,0 +1,95 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb"
+)
+
+// TypedRecord is a stream record whose images have been unmarshalled into T.
+// OldImage and NewImage are nil when the stream record does not carry them.
+type TypedRecord[T ddb.Item] struct {
+	EventID                     string
+	EventName                   types.OperationType
+	EventSourceARN              string
+	AwsRegion                   string
+	SequenceNumber              string
+	ApproximateCreationDateTime time.Time
+	Keys                        map[string]types.AttributeValue
+	OldImage                    *T
+	NewImage                    *T
+}
+
+// SubscribeTyped subscribes to the stream and invokes fn with each batch of
+// records unmarshalled into T.
+func SubscribeTyped[T ddb.Item](ctx context.Context, s *Stream, fn func(ctx context.Context, records []TypedRecord[T]) error) (*Subscriber, error) {
+	return s.subscribe(ctx, false, func(streamARN string) invokeFunc {
+		return newTypedInvoker(streamARN, fn)
+	})
+}
+
+func newTypedInvoker[T ddb.Item](streamARN string, fn func(ctx context.Context, records []TypedRecord[T]) error) invokeFunc {
+	return func(ctx context.Context, records []*types.Record) (events.DynamoDBEventResponse, error) {
+		typed := make([]TypedRecord[T], 0, len(records))
+		for _, record := range records {
+			v, err := unmarshalRecord[T](streamARN, record)
+			if err != nil {
+				return events.DynamoDBEventResponse{}, err
+			}
+			typed = append(typed, v)
+		}
+
+		return events.DynamoDBEventResponse{}, fn(ctx, typed)
+	}
+}
+
+func unmarshalRecord[T ddb.Item](streamARN string, record *types.Record) (TypedRecord[T], error) {
+	typed := TypedRecord[T]{
+		EventID:        aws.ToString(record.EventID),
+		EventName:      record.EventName,
+		EventSourceARN: streamARN,
+		AwsRegion:      aws.ToString(record.AwsRegion),
+	}
+
+	change := record.Dynamodb
+	if change == nil {
+		return typed, nil
+	}
+
+	typed.SequenceNumber = aws.ToString(change.SequenceNumber)
+	typed.ApproximateCreationDateTime = aws.ToTime(change.ApproximateCreationDateTime)
+	typed.Keys = change.Keys
+
+	var err error
+	if typed.OldImage, err = unmarshalImage[T](change.OldImage); err != nil {
+		return typed, fmt.Errorf("unable to unmarshal old image, %v: %w", typed.EventID, err)
+	}
+	if typed.NewImage, err = unmarshalImage[T](change.NewImage); err != nil {
+		return typed, fmt.Errorf("unable to unmarshal new image, %v: %w", typed.EventID, err)
+	}
+
+	return typed, nil
+}
+
+func unmarshalImage[T ddb.Item](image map[string]types.AttributeValue) (*T, error) {
+	if len(image) == 0 {
+		return nil, nil
+	}
+
+	item, err := attributevalue.FromDynamoDBStreamsMap(image)
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(T)
+	if err := attributevalue.UnmarshalMap(item, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
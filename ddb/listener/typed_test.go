@@ -0,0 +1,65 @@
+package listener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+type User struct {
+	PK   string
+	Name string
+	Age  int
+}
+
+func (User) GetType() string {
+	return "User"
+}
+
+func Test_newTypedInvoker(t *testing.T) {
+	var got []TypedRecord[User]
+	fn := func(ctx context.Context, records []TypedRecord[User]) error {
+		got = records
+		return nil
+	}
+
+	record := &types.Record{
+		EventID:   aws.String("1"),
+		EventName: types.OperationTypeModify,
+		Dynamodb: &types.StreamRecord{
+			SequenceNumber: aws.String("100"),
+			OldImage: map[string]types.AttributeValue{
+				"PK":   &types.AttributeValueMemberS{Value: "User#1"},
+				"Name": &types.AttributeValueMemberS{Value: "before"},
+			},
+			NewImage: map[string]types.AttributeValue{
+				"PK":   &types.AttributeValueMemberS{Value: "User#1"},
+				"Name": &types.AttributeValueMemberS{Value: "after"},
+				"Age":  &types.AttributeValueMemberN{Value: "42"},
+			},
+		},
+	}
+
+	invoke := newTypedInvoker("arn", fn)
+	if _, err := invoke(context.Background(), []*types.Record{record, {EventID: aws.String("2")}}); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	if got, want := len(got), 2; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := got[0].OldImage.Name, "before"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := *got[0].NewImage, (User{PK: "User#1", Name: "after", Age: 42}); got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := got[0].SequenceNumber, "100"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got[1].OldImage != nil || got[1].NewImage != nil {
+		t.Fatalf("got images %v, %v; want nil", got[1].OldImage, got[1].NewImage)
+	}
+}
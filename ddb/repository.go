@@ -0,0 +1,136 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrTypeMismatch is returned when an item's Type attribute doesn't match the
+// type it is read as.
+var ErrTypeMismatch = errors.New("item type mismatch")
+
+// Repository reads and writes items of type T, as identified by its GetType and
+// the Type attribute Save writes.
+type Repository[T Item] struct {
+	store *Store
+	typ   string
+}
+
+// NewRepository constructs a repository for items of type T.
+func NewRepository[T Item](store *Store) *Repository[T] {
+	return &Repository[T]{
+		store: store,
+		typ:   TypeOf[T](),
+	}
+}
+
+// TypeOf returns the type of items of type T, as returned by its GetType. When
+// T is a pointer, GetType is called on a newly allocated value, so methods
+// with value receivers don't dereference nil.
+func TypeOf[T Item]() string {
+	var item T
+	if t := reflect.TypeOf(item); t != nil && t.Kind() == reflect.Pointer {
+		return reflect.New(t.Elem()).Interface().(Item).GetType()
+	}
+	return item.GetType()
+}
+
+// Get fetches the item with the given keys. It fails with ErrTypeMismatch if
+// the item isn't a T.
+func (r *Repository[T]) Get(ctx context.Context, pk string, sk string) (T, error) {
+	var v T
+	item, err := r.store.Fetch(ctx, pk, sk)
+	if err != nil {
+		return v, err
+	}
+
+	if typ := itemType(item); typ != r.typ {
+		return v, fmt.Errorf("%w: got %v; want %v", ErrTypeMismatch, typ, r.typ)
+	}
+	if err := attributevalue.UnmarshalMap(item, &v); err != nil {
+		return v, fmt.Errorf("unable to unmarshal item, %v: %w", r.typ, err)
+	}
+
+	return v, nil
+}
+
+// Put saves the item.
+func (r *Repository[T]) Put(ctx context.Context, item T) error {
+	return r.store.Save(ctx, item)
+}
+
+// Create saves the item, failing with ErrAlreadyExists if it exists.
+func (r *Repository[T]) Create(ctx context.Context, item T) error {
+	return r.store.Create(ctx, item)
+}
+
+// Replace saves the item, failing with ErrNotFound unless it exists.
+func (r *Repository[T]) Replace(ctx context.Context, item T) error {
+	return r.store.Replace(ctx, item)
+}
+
+// Query runs the query to the end and returns the items that are a T, skipping
+// items of other types sharing the partition. WithItemLimit counts only those
+// items.
+func (r *Repository[T]) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...QueryOption) ([]T, error) {
+	var options queryOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var (
+		values []T
+		err    error
+	)
+	queryErr := r.store.QueryIter(ctx, input, func(items []map[string]types.AttributeValue) bool {
+		for _, item := range items {
+			if itemType(item) != r.typ {
+				continue
+			}
+
+			var v T
+			if err = attributevalue.UnmarshalMap(item, &v); err != nil {
+				err = fmt.Errorf("unable to unmarshal item, %v: %w", r.typ, err)
+				return false
+			}
+			values = append(values, v)
+
+			if options.limit > 0 && len(values) == options.limit {
+				return false
+			}
+		}
+		return true
+	})
+	if queryErr != nil {
+		return nil, queryErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Delete deletes the item with the given keys.
+func (r *Repository[T]) Delete(ctx context.Context, pk string, sk string) error {
+	return r.store.Delete(ctx, pk, sk)
+}
+
+// Discard marks the item with the given keys as discarded.
+func (r *Repository[T]) Discard(ctx context.Context, pk string, sk string) error {
+	return r.store.Discard(ctx, pk, sk)
+}
+
+// itemType returns the Type attribute of item, as written by Save.
+func itemType(item map[string]types.AttributeValue) string {
+	if v, ok := item["Type"].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package ddb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type testUser struct {
+	PK   string
+	SK   string
+	Name string
+}
+
+func (testUser) GetType() string {
+	return "User"
+}
+
+func testItem(typ string, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"PK":   map[string]string{"S": "Org#1"},
+		"SK":   map[string]string{"S": typ + "#" + name},
+		"Type": map[string]string{"S": typ},
+		"Name": map[string]string{"S": name},
+	}
+}
+
+func TestRepository_Get(t *testing.T) {
+	testCases := map[string]struct {
+		typ     string
+		wantErr error
+	}{
+		"same type":  {typ: "User"},
+		"other type": {typ: "Org", wantErr: ErrTypeMismatch},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store := newTestStore(t, func(op string, input map[string]interface{}) (int, interface{}) {
+				return http.StatusOK, map[string]interface{}{"Item": testItem(tc.typ, "ada")}
+			})
+
+			user, err := NewRepository[testUser](store).Get(context.Background(), "Org#1", tc.typ+"#ada")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got %v; want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && user.Name != "ada" {
+				t.Fatalf("got %v; want ada", user.Name)
+			}
+		})
+	}
+}
+
+func TestRepository_Query(t *testing.T) {
+	store := newTestStore(t, func(op string, input map[string]interface{}) (int, interface{}) {
+		items := []map[string]interface{}{testItem("User", "ada"), testItem("Org", "acme"), testItem("User", "grace"), testItem("User", "linus")}
+		return http.StatusOK, map[string]interface{}{"Items": items, "Count": len(items)}
+	})
+
+	users, err := NewRepository[testUser](store).Query(context.Background(), &dynamodb.QueryInput{}, WithItemLimit(2))
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if len(users) != 2 || users[0].Name != "ada" || users[1].Name != "grace" {
+		t.Fatalf("got %v; want ada and grace", users)
+	}
+}
+
+func TestRepository_pointer(t *testing.T) {
+	store := newTestStore(t, func(op string, input map[string]interface{}) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"Item": map[string]interface{}{
+			"PK":      map[string]string{"S": "pk"},
+			"SK":      map[string]string{"S": "sk"},
+			"Type":    map[string]string{"S": "Doc"},
+			"Version": map[string]string{"N": "2"},
+		}}
+	})
+
+	doc, err := NewRepository[*testDoc](store).Get(context.Background(), "pk", "sk")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if doc == nil || doc.Version != 2 {
+		t.Fatalf("got %v; want version 2", doc)
+	}
+}
@@ -3,7 +3,10 @@ package ddb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,21 +20,72 @@ import (
 type Store struct {
 	client    *dynamodb.Client
 	tableName *string
+	cursorKey []byte
+}
+
+type StoreOption func(*Store)
+
+// WithCursorKey sets the secret QueryPage signs its cursors with. Every
+// instance serving the same cursors must share it.
+func WithCursorKey(key []byte) StoreOption {
+	return func(s *Store) {
+		s.cursorKey = key
+	}
 }
 
 // New constructs a DynamoDB store.
-func NewStore(client *dynamodb.Client, streamClient *dynamodbstreams.Client, tableName *string) *Store {
-	return &Store{
+func NewStore(client *dynamodb.Client, streamClient *dynamodbstreams.Client, tableName *string, opts ...StoreOption) *Store {
+	s := &Store{
 		client:    client,
 		tableName: tableName,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 type Item interface {
 	GetType() string
 }
 
+// Versioned is implemented by items that opt into optimistic concurrency
+// control. GetVersion returns the version the item was read at, or 0 if it
+// was never saved with one; Save stores the next version in the Version
+// attribute. Items that also implement SetVersion(int64) are updated with it.
+type Versioned interface {
+	GetVersion() int64
+}
+
+// Save writes the item, replacing any item with the same keys. A Versioned
+// item is only written over the version it was read at, and fails with
+// ErrVersionConflict otherwise.
 func (s *Store) Save(ctx context.Context, item Item) error {
+	return s.put(ctx, item, putAny)
+}
+
+// Create writes the item, failing with ErrAlreadyExists if an item with the
+// same keys exists.
+func (s *Store) Create(ctx context.Context, item Item) error {
+	return s.put(ctx, item, putNew)
+}
+
+// Replace writes the item over the one with the same keys, failing with
+// ErrNotFound if there is none.
+func (s *Store) Replace(ctx context.Context, item Item) error {
+	return s.put(ctx, item, putExisting)
+}
+
+type putMode int
+
+const (
+	putAny putMode = iota
+	putNew
+	putExisting
+)
+
+func (s *Store) put(ctx context.Context, item Item, mode putMode) error {
 	ddbItem, err := attributevalue.MarshalMap(item)
 	if err != nil {
 		return fmt.Errorf("av.MarshalMap: %w", err)
@@ -54,27 +108,169 @@ func (s *Store) Save(ctx context.Context, item Item) error {
 		Item:      ddbItem,
 	}
 
+	var conditions []string
+	switch mode {
+	case putNew:
+		conditions = append(conditions, "attribute_not_exists(PK)")
+	case putExisting:
+		conditions = append(conditions, "attribute_exists(PK)")
+	}
+
+	versioned, isVersioned := item.(Versioned)
+	var version int64
+	if isVersioned {
+		version = versioned.GetVersion()
+		ddbItem["Version"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(version+1, 10),
+		}
+
+		input.ExpressionAttributeNames = map[string]string{"#version": "Version"}
+		if version == 0 {
+			conditions = append(conditions, "attribute_not_exists(#version)")
+		} else {
+			conditions = append(conditions, "#version = :version")
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			}
+		}
+	}
+
+	if len(conditions) > 0 {
+		input.ConditionExpression = aws.String(strings.Join(conditions, " AND "))
+		input.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+
 	_, err = s.client.PutItem(ctx, &input)
 	if err != nil {
-		return fmt.Errorf("ddb.PutItem: %w", err)
+		return fmt.Errorf("ddb.PutItem: %w", putError(err, mode))
+	}
+
+	if setter, ok := item.(interface{ SetVersion(int64) }); ok && isVersioned {
+		setter.SetVersion(version + 1)
 	}
 
 	return nil
 }
 
+// putError tells apart why a put's condition failed, from the item that was
+// there instead.
+func putError(err error, mode putMode) error {
+	err = mapError(err)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return err
+	}
+
+	switch {
+	case conditionFailed.Item == nil && mode == putExisting:
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case conditionFailed.Item != nil && mode == putNew:
+		return fmt.Errorf("%w: %w", ErrAlreadyExists, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrVersionConflict, err)
+	}
+}
+
+// Query returns a single page of results, at most 1 MB of items. Use QueryAll
+// or QueryIter to read every page.
 func (s *Store) Query(ctx context.Context, input *dynamodb.QueryInput) ([]map[string]types.AttributeValue, error) {
 	input.TableName = s.tableName
 	out, err := s.client.Query(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("ddb.QueryPages: %w", err)
+		return nil, fmt.Errorf("ddb.QueryPages: %w", mapError(err))
 	}
 
 	return out.Items, nil
 }
 
-func (s *Store) Fetch(ctx context.Context, pk string, sk string) (map[string]types.AttributeValue, error) {
+// QueryOption configures QueryAll.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	limit int
+}
+
+// WithItemLimit stops the query once n items have been read. Unlike
+// QueryInput.Limit, which caps the items evaluated per page, it applies
+// across pages.
+func WithItemLimit(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.limit = n
+	}
+}
+
+// QueryAll runs the query to the end, following LastEvaluatedKey across pages,
+// and returns every item read.
+func (s *Store) QueryAll(ctx context.Context, input *dynamodb.QueryInput, opts ...QueryOption) ([]map[string]types.AttributeValue, error) {
+	var options queryOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var items []map[string]types.AttributeValue
+	err := s.QueryIter(ctx, input, func(page []map[string]types.AttributeValue) bool {
+		items = append(items, page...)
+		if options.limit > 0 && len(items) >= options.limit {
+			items = items[:options.limit]
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// QueryIter runs the query page by page, calling fn with the items of each
+// non-empty page. Returning false from fn stops the query without reading
+// further pages.
+func (s *Store) QueryIter(ctx context.Context, input *dynamodb.QueryInput, fn func(items []map[string]types.AttributeValue) bool) error {
+	input.TableName = s.tableName
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("ddb.Query: %w", mapError(err))
+		}
+		if len(out.Items) == 0 {
+			continue
+		}
+		if !fn(out.Items) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// FetchOption configures Fetch.
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	consistentRead bool
+}
+
+// WithConsistentRead reads the item with a strongly consistent read, so it
+// reflects every write that succeeded before it.
+func WithConsistentRead() FetchOption {
+	return func(o *fetchOptions) {
+		o.consistentRead = true
+	}
+}
+
+// Fetch returns the item with the given keys, or ErrNotFound.
+func (s *Store) Fetch(ctx context.Context, pk string, sk string, opts ...FetchOption) (map[string]types.AttributeValue, error) {
+	var options fetchOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: s.tableName,
+		TableName:      s.tableName,
+		ConsistentRead: aws.Bool(options.consistentRead),
 		Key: map[string]types.AttributeValue{
 			"PK": &types.AttributeValueMemberS{
 				Value: pk,
@@ -85,16 +281,18 @@ func (s *Store) Fetch(ctx context.Context, pk string, sk string) (map[string]typ
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("ddb.GetItem: %w", err)
+		return nil, fmt.Errorf("ddb.GetItem: %w", mapError(err))
 	}
 
 	if len(out.Item) == 0 {
-		return nil, fmt.Errorf("item not found")
+		return nil, ErrNotFound
 	}
 
 	return out.Item, nil
 }
 
+// Discard marks the item with the given keys as discarded, or returns
+// ErrNotFound.
 func (s *Store) Discard(ctx context.Context, pk string, sk string) error {
 	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: s.tableName,
@@ -115,6 +313,11 @@ func (s *Store) Discard(ctx context.Context, pk string, sk string) error {
 		},
 	})
 	if err != nil {
+		err = mapError(err)
+		if errors.Is(err, ErrConditionFailed) {
+			// the condition only checks the item exists
+			return fmt.Errorf("ddb.DiscardItem: %w: %w", ErrNotFound, err)
+		}
 		return fmt.Errorf("ddb.DiscardItem: %w", err)
 	}
 
@@ -134,7 +337,7 @@ func (s *Store) Delete(ctx context.Context, pk string, sk string) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("ddb.DeleteItem: %w", err)
+		return fmt.Errorf("ddb.DeleteItem: %w", mapError(err))
 	}
 
 	return nil
@@ -147,7 +350,7 @@ func (s *Store) Count(ctx context.Context) (int32, error) {
 	}
 	resp, err := s.client.Scan(ctx, input)
 	if err != nil {
-		return 0, fmt.Errorf("failed to scan the table, %w", err)
+		return 0, fmt.Errorf("failed to scan the table, %w", mapError(err))
 	}
 	return resp.Count, nil
 }
@@ -0,0 +1,228 @@
+package ddb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/code-inbox/mason-go/awslocal"
+)
+
+// newTestStore returns a Store backed by a fake DynamoDB endpoint that answers
+// each call with respond, given the operation name (e.g. "Query") and the
+// decoded input.
+func newTestStore(t *testing.T, respond func(op string, input map[string]interface{}) (int, interface{}), opts ...StoreOption) *Store {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Errorf("got %v; want nil", err)
+		}
+
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		status, body := respond(op, input)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	cfg, err := awslocal.NewConfig(host, port)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	return NewStore(client, nil, aws.String("test"), opts...)
+}
+
+// pagedQuery answers Query calls with pages of size items each, numbering the
+// items from 0 up to total.
+func pagedQuery(t *testing.T, total int, size int, calls *int) func(string, map[string]interface{}) (int, interface{}) {
+	return func(op string, input map[string]interface{}) (int, interface{}) {
+		if op != "Query" {
+			t.Errorf("got %v; want Query", op)
+		}
+		*calls++
+
+		start := 0
+		if key, ok := input["ExclusiveStartKey"].(map[string]interface{}); ok {
+			n, _ := strconv.Atoi(key["SK"].(map[string]interface{})["S"].(string))
+			start = n + 1
+		}
+
+		var items []map[string]interface{}
+		for i := start; i < total && i < start+size; i++ {
+			items = append(items, map[string]interface{}{
+				"PK": map[string]string{"S": "User"},
+				"SK": map[string]string{"S": strconv.Itoa(i)},
+			})
+		}
+
+		out := map[string]interface{}{"Items": items, "Count": len(items)}
+		if start+size < total {
+			out["LastEvaluatedKey"] = items[len(items)-1]
+		}
+		return http.StatusOK, out
+	}
+}
+
+func TestStore_QueryAll(t *testing.T) {
+	testCases := map[string]struct {
+		opts      []QueryOption
+		wantItems int
+		wantCalls int
+	}{
+		"every page": {wantItems: 5, wantCalls: 3},
+		"item limit": {opts: []QueryOption{WithItemLimit(3)}, wantItems: 3, wantCalls: 2},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			var calls int
+			store := newTestStore(t, pagedQuery(t, 5, 2, &calls))
+
+			items, err := store.QueryAll(context.Background(), &dynamodb.QueryInput{}, tc.opts...)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			if len(items) != tc.wantItems {
+				t.Fatalf("got %v; want %v", len(items), tc.wantItems)
+			}
+			if calls != tc.wantCalls {
+				t.Fatalf("got %v; want %v", calls, tc.wantCalls)
+			}
+			if got := items[len(items)-1]["SK"].(*types.AttributeValueMemberS).Value; got != strconv.Itoa(tc.wantItems-1) {
+				t.Fatalf("got %v; want %v", got, tc.wantItems-1)
+			}
+		})
+	}
+}
+
+func TestStore_QueryIter_stop(t *testing.T) {
+	var calls int
+	store := newTestStore(t, pagedQuery(t, 5, 2, &calls))
+
+	var pages int
+	err := store.QueryIter(context.Background(), &dynamodb.QueryInput{}, func(items []map[string]types.AttributeValue) bool {
+		pages++
+		return false
+	})
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if pages != 1 || calls != 1 {
+		t.Fatalf("got %v pages, %v calls; want 1 page, 1 call", pages, calls)
+	}
+}
+
+type testDoc struct {
+	PK      string
+	SK      string
+	Version int64
+}
+
+func (testDoc) GetType() string {
+	return "Doc"
+}
+
+func (d testDoc) GetVersion() int64 {
+	return d.Version
+}
+
+func (d *testDoc) SetVersion(v int64) {
+	d.Version = v
+}
+
+func TestStore_Save_versioned(t *testing.T) {
+	var input map[string]interface{}
+	store := newTestStore(t, func(_ string, in map[string]interface{}) (int, interface{}) {
+		input = in
+		return http.StatusOK, map[string]interface{}{}
+	})
+
+	doc := &testDoc{PK: "pk", SK: "sk", Version: 3}
+	if err := store.Save(context.Background(), doc); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	if got, want := input["ConditionExpression"], "#version = :version"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got := input["Item"].(map[string]interface{})["Version"].(map[string]interface{})["N"]; got != "4" {
+		t.Fatalf("got %v; want 4", got)
+	}
+	if doc.Version != 4 {
+		t.Fatalf("got %v; want 4", doc.Version)
+	}
+}
+
+func TestStore_put_conditionFailed(t *testing.T) {
+	create := func(s *Store, doc *testDoc) error { return s.Create(context.Background(), doc) }
+	replace := func(s *Store, doc *testDoc) error { return s.Replace(context.Background(), doc) }
+	save := func(s *Store, doc *testDoc) error { return s.Save(context.Background(), doc) }
+
+	testCases := map[string]struct {
+		existing bool
+		call     func(s *Store, doc *testDoc) error
+		wantErr  error
+	}{
+		"create existing":   {existing: true, call: create, wantErr: ErrAlreadyExists},
+		"replace missing":   {existing: false, call: replace, wantErr: ErrNotFound},
+		"replace changed":   {existing: true, call: replace, wantErr: ErrVersionConflict},
+		"save changed":      {existing: true, call: save, wantErr: ErrVersionConflict},
+		"save deleted item": {existing: false, call: save, wantErr: ErrVersionConflict},
+	}
+
+	for label, tc := range testCases {
+		t.Run(label, func(t *testing.T) {
+			store := newTestStore(t, func(string, map[string]interface{}) (int, interface{}) {
+				body := map[string]interface{}{
+					"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+					"message": "The conditional request failed",
+				}
+				if tc.existing {
+					body["Item"] = map[string]interface{}{"Version": map[string]string{"N": "5"}}
+				}
+				return http.StatusBadRequest, body
+			})
+
+			doc := &testDoc{PK: "pk", SK: "sk", Version: 4}
+			err := tc.call(store, doc)
+			if !errors.Is(err, tc.wantErr) || !errors.Is(err, ErrConditionFailed) {
+				t.Fatalf("got %v; want %v", err, tc.wantErr)
+			}
+			if doc.Version != 4 {
+				t.Fatalf("got %v; want 4", doc.Version)
+			}
+		})
+	}
+}
+
+func TestStore_Fetch_consistentRead(t *testing.T) {
+	var input map[string]interface{}
+	store := newTestStore(t, func(_ string, in map[string]interface{}) (int, interface{}) {
+		input = in
+		return http.StatusOK, map[string]interface{}{"Item": map[string]interface{}{"PK": map[string]string{"S": "pk"}}}
+	})
+
+	if _, err := store.Fetch(context.Background(), "pk", "sk", WithConsistentRead()); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if got := input["ConsistentRead"]; got != true {
+		t.Fatalf("got %v; want true", got)
+	}
+}
@@ -0,0 +1,18 @@
+// Package logging holds the logging helpers shared by the packages of this
+// module.
+package logging
+
+import (
+	"io"
+	"log/slog"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// OrDiscard returns logger, or a logger that discards everything when nil.
+func OrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discard
+	}
+	return logger
+}
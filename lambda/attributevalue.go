@@ -0,0 +1,23 @@
+package lambda
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	typesStream "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+)
+
+// ToStreamAttributeValues converts the keys or image of a Lambda DynamoDB
+// event record to the attribute values read from DynamoDB Streams.
+//
+// Deprecated: use ddbstream.ToStreamAttributeValues.
+func ToStreamAttributeValues(m map[string]events.DynamoDBAttributeValue) map[string]typesStream.AttributeValue {
+	return ddbstream.ToStreamAttributeValues(m)
+}
+
+// ToStreamAttributeValue converts a single attribute value of a Lambda DynamoDB
+// event record to the attribute value read from DynamoDB Streams.
+//
+// Deprecated: use ddbstream.ToStreamAttributeValue.
+func ToStreamAttributeValue(av events.DynamoDBAttributeValue) typesStream.AttributeValue {
+	return ddbstream.ToStreamAttributeValue(av)
+}
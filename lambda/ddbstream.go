@@ -3,18 +3,49 @@ package lambda
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	typesStream "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+	"github.com/code-inbox/mason-go/internal/logging"
 )
 
+// Processor processes the records of a batch.
+//
+// Deprecated: implement ddbstream.Processor and set DDBStream.StreamProcessor,
+// so the same processor also runs in listener.Subscriber.
 type Processor interface {
 	Process(ctx context.Context, records []*typesStream.Record) error
 }
 
+// BatchProcessor is implemented by processors that report partial batch
+// failures. Each failure identifies a record by its sequence number so that
+// Lambda retries only the failed record and those after it in the same shard.
+// Requires ReportBatchItemFailures to be enabled on the event source mapping.
+//
+// Deprecated: implement ddbstream.Processor and set DDBStream.StreamProcessor,
+// whose response reports failures the same way.
+type BatchProcessor interface {
+	ProcessBatch(ctx context.Context, records []*typesStream.Record) (events.DynamoDBEventResponse, error)
+}
+
 // DDBStream represents the lambda DDBStream handler.
 type DDBStream struct {
+	// Processor is used when StreamProcessor is not set.
+	//
+	// Deprecated: use StreamProcessor.
 	Processor Processor
+
+	// StreamProcessor processes each batch. It is the contract shared with
+	// listener.Subscriber, so the same processor runs in Lambda and locally.
+	// Failures reported in its response require ReportBatchItemFailures to be
+	// enabled on the event source mapping.
+	StreamProcessor ddbstream.Processor
+
+	// Logger, when set, logs each batch and its failures.
+	Logger *slog.Logger
 }
 
 var opMapping = map[string]typesStream.OperationType{
@@ -23,31 +54,55 @@ var opMapping = map[string]typesStream.OperationType{
 	"REMOVE": typesStream.OperationTypeRemove,
 }
 
-// Handler processes the DynamoDB event.
-func (d *DDBStream) Handler(ctx context.Context, evt events.DynamoDBEvent) error {
+// Handler processes the DynamoDB event with the StreamProcessor. The response
+// carries the sequence numbers of the records that failed.
+func (d *DDBStream) Handler(ctx context.Context, evt events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
 	records := make([]*typesStream.Record, len(evt.Records))
 	for i, record := range evt.Records {
 		change := record.Change
 		records[i] = &typesStream.Record{
-			AwsRegion: &record.AWSRegion,
+			AwsRegion: aws.String(record.AWSRegion),
 			Dynamodb: &typesStream.StreamRecord{
-				ApproximateCreationDateTime: &change.ApproximateCreationDateTime.Time,
-				Keys: map[string]typesStream.AttributeValue{
-					"PK": &typesStream.AttributeValueMemberS{Value: change.Keys["PK"].String()},
-					"SK": &typesStream.AttributeValueMemberS{Value: change.Keys["SK"].String()},
-				},
-				NewImage:       map[string]typesStream.AttributeValue{},
-				OldImage:       map[string]typesStream.AttributeValue{},
-				SequenceNumber: &change.SequenceNumber,
-				SizeBytes:      &change.SizeBytes,
-				StreamViewType: typesStream.StreamViewTypeKeysOnly,
+				ApproximateCreationDateTime: aws.Time(change.ApproximateCreationDateTime.Time),
+				Keys:                        ddbstream.ToStreamAttributeValues(change.Keys),
+				NewImage:                    ddbstream.ToStreamAttributeValues(change.NewImage),
+				OldImage:                    ddbstream.ToStreamAttributeValues(change.OldImage),
+				SequenceNumber:              aws.String(change.SequenceNumber),
+				SizeBytes:                   aws.Int64(change.SizeBytes),
+				StreamViewType:              typesStream.StreamViewType(change.StreamViewType),
 			},
-			EventID:      &record.EventID,
+			EventID:      aws.String(record.EventID),
 			EventName:    opMapping[record.EventName],
-			EventSource:  &record.EventSource,
-			EventVersion: &record.EventVersion,
+			EventSource:  aws.String(record.EventSource),
+			EventVersion: aws.String(record.EventVersion),
 		}
 	}
 
-	return d.Processor.Process(ctx, records)
+	logger := logging.OrDiscard(d.Logger)
+	var md ddbstream.Metadata
+	if len(evt.Records) > 0 {
+		md.StreamARN = evt.Records[0].EventSourceArn
+	}
+	logger.Debug("processing records", "streamARN", md.StreamARN, "records", len(records))
+
+	ctx = ddbstream.NewContext(ctx, md)
+	var (
+		response events.DynamoDBEventResponse
+		err      error
+	)
+	if d.StreamProcessor != nil {
+		response, err = d.StreamProcessor.Process(ctx, ddbstream.Batch{Metadata: md, Records: records})
+	} else if p, ok := d.Processor.(BatchProcessor); ok {
+		response, err = p.ProcessBatch(ctx, records)
+	} else {
+		err = d.Processor.Process(ctx, records)
+	}
+	if err != nil {
+		logger.Error("processing records failed", "streamARN", md.StreamARN, "records", len(records), "err", err)
+	}
+	for _, failure := range response.BatchItemFailures {
+		logger.Warn("record failed", "streamARN", md.StreamARN, "sequenceNumber", failure.ItemIdentifier)
+	}
+
+	return response, err
 }
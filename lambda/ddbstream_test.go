@@ -0,0 +1,86 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	typesStream "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+)
+
+type recordingProcessor struct {
+	batch ddbstream.Batch
+}
+
+func (p *recordingProcessor) Process(_ context.Context, batch ddbstream.Batch) (events.DynamoDBEventResponse, error) {
+	p.batch = batch
+	return events.DynamoDBEventResponse{}, nil
+}
+
+func TestDDBStream_Handler_keys(t *testing.T) {
+	data := `{
+		"Records": [{
+			"eventID": "1",
+			"eventName": "INSERT",
+			"eventSourceARN": "arn:aws:dynamodb:us-east-1:123456789012:table/test/stream/label",
+			"dynamodb": {
+				"Keys": {"OrgID": {"S": "org-1"}, "Version": {"N": "7"}},
+				"SequenceNumber": "100",
+				"StreamViewType": "KEYS_ONLY"
+			}
+		}]
+	}`
+
+	var evt events.DynamoDBEvent
+	if err := json.Unmarshal([]byte(data), &evt); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	processor := &recordingProcessor{}
+	stream := &DDBStream{StreamProcessor: processor}
+	if _, err := stream.Handler(context.Background(), evt); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+
+	want := map[string]typesStream.AttributeValue{
+		"OrgID":   &typesStream.AttributeValueMemberS{Value: "org-1"},
+		"Version": &typesStream.AttributeValueMemberN{Value: "7"},
+	}
+	if got := processor.batch.Records[0].Dynamodb.Keys; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got, want := processor.batch.StreamARN, evt.Records[0].EventSourceArn; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+	if got := processor.batch.Records[0].Dynamodb.NewImage; got != nil {
+		t.Fatalf("got %v; want nil", got)
+	}
+}
+
+type recordsProcessor struct {
+	records []*typesStream.Record
+}
+
+func (p *recordsProcessor) Process(_ context.Context, records []*typesStream.Record) error {
+	p.records = records
+	return nil
+}
+
+func TestDDBStream_Handler_processor(t *testing.T) {
+	evt := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{{
+		EventID: "1",
+		Change:  events.DynamoDBStreamRecord{SequenceNumber: "100"},
+	}}}
+
+	processor := &recordsProcessor{}
+	stream := &DDBStream{Processor: processor}
+	if _, err := stream.Handler(context.Background(), evt); err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if len(processor.records) != 1 {
+		t.Fatalf("got %v; want 1 record", len(processor.records))
+	}
+}
@@ -4,16 +4,22 @@ package lambda
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	lambdaproxy "github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/code-inbox/mason-go/internal/logging"
 )
 
 type HTTP struct {
 	App http.Handler
+
+	// Logger, when set, logs events that cannot be translated into requests.
+	Logger *slog.Logger
 }
 
 // APIGWHandler routes the lambda request (proxied from the API GW) to an internal endpoint.
@@ -23,6 +29,7 @@ func (l HTTP) APIGWHandler(ctx context.Context, request events.APIGatewayV2HTTPR
 
 	r, err := ra.EventToRequestWithContext(ctx, request)
 	if err != nil {
+		logging.OrDiscard(l.Logger).Error("event to request failed", "requestID", request.RequestContext.RequestID, "err", err)
 		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("event to request: %w", err)
 	}
 
@@ -32,12 +39,43 @@ func (l HTTP) APIGWHandler(ctx context.Context, request events.APIGatewayV2HTTPR
 	return w.GetProxyResponse()
 }
 
+// APIGWv1Handler routes the lambda request (proxied from an API GW REST API) to
+// an internal endpoint. The stage and stage variables are available through
+// lambdaproxy.GetAPIGatewayContextFromContext and GetStageVarsFromContext,
+// the path parameters through PathParameters.
+func (l HTTP) APIGWv1Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var ra lambdaproxy.RequestAccessor
+
+	r, err := ra.EventToRequestWithContext(ctx, request)
+	if err != nil {
+		logging.OrDiscard(l.Logger).Error("event to request failed", "requestID", request.RequestContext.RequestID, "err", err)
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("event to request: %w", err)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), pathParametersKey{}, request.PathParameters))
+
+	w := lambdaproxy.NewProxyResponseWriter()
+	l.App.ServeHTTP(w, r)
+
+	return w.GetProxyResponse()
+}
+
+type pathParametersKey struct{}
+
+// PathParameters returns the path parameters API Gateway matched for the
+// request, keyed by the names in the resource path, e.g. "id" for
+// /users/{id}.
+func PathParameters(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(pathParametersKey{}).(map[string]string)
+	return params
+}
+
 // ALBHandler routes the lambda request (proxied from the ALB) to an internal endpoint.
 func (l HTTP) ALBHandler(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	var ra lambdaproxy.RequestAccessorALB
 
 	r, err := ra.EventToRequestWithContext(ctx, request)
 	if err != nil {
+		logging.OrDiscard(l.Logger).Error("event to request failed", "path", request.Path, "err", err)
 		return events.ALBTargetGroupResponse{}, fmt.Errorf("ra.EventToRequestWithContext: %w", err)
 	}
 
@@ -56,12 +94,173 @@ func (l HTTP) ALBHandler(ctx context.Context, request events.ALBTargetGroupReque
 
 	evt, err := w.GetProxyResponse()
 	if err != nil {
+		logging.OrDiscard(l.Logger).Error("proxy response failed", "path", request.Path, "err", err)
 		return events.ALBTargetGroupResponse{}, fmt.Errorf("w.GetProxyResponse: %w", err)
 	}
 
 	return evt, nil
 }
 
+// Mode selects the events HTTP.Handler synthesizes from requests.
+type Mode int
+
+const (
+	// ModeAPIGatewayV2 delivers requests as API Gateway HTTP API (payload
+	// version 2.0) events, the format Function URLs use too.
+	ModeAPIGatewayV2 Mode = iota
+
+	// ModeALB delivers requests as Application Load Balancer events.
+	ModeALB
+
+	// ModeAPIGatewayV1 delivers requests as API Gateway REST API events, with
+	// every path matched by a {proxy+} resource.
+	ModeAPIGatewayV1
+
+	// ModeFunctionURLStream delivers requests as Function URL events and
+	// streams the response, as a Function URL with InvokeMode RESPONSE_STREAM
+	// does.
+	ModeFunctionURLStream
+)
+
+// Handler returns an http.Handler that translates each request into the event
+// of the given mode, runs it through the matching Lambda handler and writes
+// the proxy response back. It exercises the exact event translation used in
+// Lambda, without deploying.
+func (l HTTP) Handler(mode Mode) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := &startedWriter{ResponseWriter: rw}
+
+		var err error
+		switch mode {
+		case ModeAPIGatewayV2:
+			err = l.serveAPIGatewayV2(w, r)
+		case ModeALB:
+			err = l.serveALB(w, r)
+		case ModeAPIGatewayV1:
+			err = l.serveAPIGatewayV1(w, r)
+		case ModeFunctionURLStream:
+			err = l.serveFunctionURLStream(w, r)
+		default:
+			err = fmt.Errorf("unknown mode, %v", mode)
+		}
+
+		if err != nil {
+			logging.OrDiscard(l.Logger).Error("serve request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+			// once the response has started, it can't be replaced by an error
+			if !w.started {
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			}
+		}
+	})
+}
+
+// startedWriter records whether the response has started, that is whether
+// its status has been sent.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) WriteHeader(status int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *startedWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *startedWriter) Flush() {
+	w.started = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *startedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ListenAndServe listens on addr and serves requests through the Lambda
+// handler of the given mode. It is meant for local development; serve Handler
+// from your own http.Server to control timeouts and graceful shutdown.
+func (l HTTP) ListenAndServe(addr string, mode Mode) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           l.Handler(mode),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	// streamed responses, such as server-sent events, may outlive any write timeout
+	if mode != ModeFunctionURLStream {
+		server.WriteTimeout = 30 * time.Second
+	}
+
+	return server.ListenAndServe()
+}
+
+func (l HTTP) serveAPIGatewayV2(w http.ResponseWriter, r *http.Request) error {
+	evt, err := NewAPIGatewayV2Request(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.APIGWHandler(r.Context(), evt)
+	if err != nil {
+		return err
+	}
+	return WriteAPIGatewayV2Response(w, res)
+}
+
+func (l HTTP) serveALB(w http.ResponseWriter, r *http.Request) error {
+	evt, err := NewALBTargetGroupRequest(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.ALBHandler(r.Context(), evt)
+	if err != nil {
+		return err
+	}
+	return WriteALBTargetGroupResponse(w, res)
+}
+
+func (l HTTP) serveAPIGatewayV1(w http.ResponseWriter, r *http.Request) error {
+	evt, err := NewAPIGatewayV1Request(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.APIGWv1Handler(r.Context(), evt)
+	if err != nil {
+		return err
+	}
+	return WriteAPIGatewayV1Response(w, res)
+}
+
+func (l HTTP) serveFunctionURLStream(w http.ResponseWriter, r *http.Request) error {
+	evt, err := NewFunctionURLRequest(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.FunctionURLStreamHandler(r.Context(), evt)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	// the status has been sent by the time the stream fails, so the stream is
+	// cut short, as Lambda does, and closing res fails the app's writes
+	if err := WriteFunctionURLStreamingResponse(w, res); err != nil {
+		logging.OrDiscard(l.Logger).Error("stream response failed", "path", r.URL.Path, "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	return nil
+}
+
 var doubleEncodedRE = regexp.MustCompile(`%25[0-9A-Fa-f]{2}`)
 
 func isLikelyDoubleEscaped(raw string) bool {
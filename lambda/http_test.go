@@ -0,0 +1,186 @@
+package lambda
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHTTP_Handler(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+		var session string
+		if cookie != nil {
+			session = cookie.Value
+		}
+
+		w.Header().Add("X-Values", "a")
+		w.Header().Add("X-Values", "b")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%v %v q=%v session=%v accept=%v body=%x",
+			r.Method, r.URL.Path, r.URL.Query().Get("q"), session, r.Header.Values("Accept"), body)
+	})
+
+	testCases := map[string]Mode{
+		"api gateway v2": ModeAPIGatewayV2,
+		"alb":            ModeALB,
+		"api gateway v1": ModeAPIGatewayV1,
+		"function url":   ModeFunctionURLStream,
+	}
+
+	for label, mode := range testCases {
+		t.Run(label, func(t *testing.T) {
+			server := httptest.NewServer(HTTP{App: app}.Handler(mode))
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/users?q=key%3Avalue", bytes.NewReader([]byte{0xff, 0x00}))
+			req.Header.Add("Accept", "text/plain")
+			req.Header.Add("Accept", "application/json")
+			req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("got %v; want nil", err)
+			}
+			defer res.Body.Close()
+			got, _ := io.ReadAll(res.Body)
+
+			if res.StatusCode != http.StatusCreated {
+				t.Fatalf("got %v; want %v", res.StatusCode, http.StatusCreated)
+			}
+			if want := "POST /users q=key:value session=abc accept=[text/plain application/json] body=ff00"; string(got) != want {
+				t.Fatalf("got %v; want %v", string(got), want)
+			}
+			// API Gateway v2 joins the values of a header with commas
+			if got := strings.Join(res.Header.Values("X-Values"), ","); got != "a,b" {
+				t.Fatalf("got %v; want a,b", got)
+			}
+		})
+	}
+}
+
+func TestHTTP_APIGWv1Handler(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v %v", r.URL.Path, PathParameters(r.Context())["id"])
+	})
+
+	request := events.APIGatewayProxyRequest{
+		Resource:       "/users/{id}",
+		Path:           "/users/42",
+		HTTPMethod:     http.MethodGet,
+		PathParameters: map[string]string{"id": "42"},
+		RequestContext: events.APIGatewayProxyRequestContext{Stage: "prod", DomainName: "example.com"},
+	}
+	res, err := HTTP{App: app}.APIGWv1Handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if want := "/users/42 42"; res.Body != want {
+		t.Fatalf("got %v; want %v", res.Body, want)
+	}
+}
+
+func TestHTTP_FunctionURLStreamHandler(t *testing.T) {
+	next := make(chan struct{})
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 2; i++ {
+			fmt.Fprintf(w, "data: %v\n\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	})
+
+	server := httptest.NewServer(HTTP{App: app}.Handler(ModeFunctionURLStream))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer res.Body.Close()
+
+	if got, want := res.Header.Get("Content-Type"), "text/event-stream"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+
+	// each event arrives while the app is still blocked writing the stream
+	reader := bufio.NewReader(res.Body)
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if want := fmt.Sprintf("data: %v\n", i); line != want {
+			t.Fatalf("got %q; want %q", line, want)
+		}
+		reader.ReadString('\n')
+		next <- struct{}{}
+	}
+}
+
+// failingWriter fails every write of the body, as when the client has gone.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (w *failingWriter) WriteHeader(status int) {
+	w.statuses = append(w.statuses, status)
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestHTTP_Handler_failedAfterStarted(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "created")
+	})
+
+	w := &failingWriter{ResponseRecorder: httptest.NewRecorder()}
+	r := httptest.NewRequest(http.MethodPost, "/users", nil)
+	HTTP{App: app}.Handler(ModeAPIGatewayV2).ServeHTTP(w, r)
+
+	if want := []int{http.StatusCreated}; !reflect.DeepEqual(w.statuses, want) {
+		t.Fatalf("got %v; want %v", w.statuses, want)
+	}
+}
+
+func TestHTTP_FunctionURLStreamHandler_failedMidway(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: 0\n\n")
+		w.(http.Flusher).Flush()
+		panic("boom")
+	})
+
+	server := httptest.NewServer(HTTP{App: app}.Handler(ModeFunctionURLStream))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	defer res.Body.Close()
+
+	// the stream is cut short rather than ending with an error body
+	got, err := io.ReadAll(res.Body)
+	if err == nil {
+		t.Fatalf("got nil; want the stream cut short")
+	}
+	if want := "data: 0\n\n"; string(got) != want {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+}
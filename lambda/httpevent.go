@@ -0,0 +1,381 @@
+package lambda
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// NewAPIGatewayV2Request synthesizes the event API Gateway (HTTP API, payload
+// version 2.0), or a Function URL, would deliver for r.
+func NewAPIGatewayV2Request(r *http.Request) (events.APIGatewayV2HTTPRequest, error) {
+	body, isBase64Encoded, err := readEventBody(r)
+	if err != nil {
+		return events.APIGatewayV2HTTPRequest{}, err
+	}
+
+	headers := map[string]string{}
+	var cookies []string
+	for name, values := range r.Header {
+		name = strings.ToLower(name)
+		if name == "cookie" {
+			for _, v := range values {
+				cookies = append(cookies, strings.Split(v, "; ")...)
+			}
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+	headers["host"] = r.Host
+	for name, value := range forwardedHeaders(r) {
+		headers[name] = value
+	}
+
+	var query map[string]string
+	if values := r.URL.Query(); len(values) > 0 {
+		query = make(map[string]string, len(values))
+		for name, v := range values {
+			query[name] = strings.Join(v, ",")
+		}
+	}
+
+	now := time.Now()
+	return events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              "$default",
+		RawPath:               r.URL.Path,
+		RawQueryString:        r.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: query,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			AccountID:    "000000000000",
+			APIID:        "local",
+			DomainName:   r.Host,
+			DomainPrefix: strings.Split(r.Host, ".")[0],
+			RequestID:    uuid.NewString(),
+			RouteKey:     "$default",
+			Stage:        "$default",
+			Time:         now.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			TimeEpoch:    now.UnixMilli(),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Protocol:  r.Proto,
+				SourceIP:  remoteIP(r),
+				UserAgent: r.UserAgent(),
+			},
+		},
+		Body:            body,
+		IsBase64Encoded: isBase64Encoded,
+	}, nil
+}
+
+// WriteAPIGatewayV2Response writes res to w as API Gateway would.
+func WriteAPIGatewayV2Response(w http.ResponseWriter, res events.APIGatewayV2HTTPResponse) error {
+	for name, value := range res.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range res.MultiValueHeaders {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	for _, cookie := range res.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+
+	status := res.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return writeEventBody(w, status, res.Body, res.IsBase64Encoded)
+}
+
+// NewALBTargetGroupRequest synthesizes the event an Application Load Balancer
+// would deliver for r, with multi-value headers enabled on the target group.
+// As with ALB, query parameters are passed as they were sent, still escaped.
+func NewALBTargetGroupRequest(r *http.Request) (events.ALBTargetGroupRequest, error) {
+	body, isBase64Encoded, err := readEventBody(r)
+	if err != nil {
+		return events.ALBTargetGroupRequest{}, err
+	}
+
+	headers := map[string][]string{}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = values
+	}
+	headers["host"] = []string{r.Host}
+	for name, value := range forwardedHeaders(r) {
+		headers[name] = []string{value}
+	}
+
+	query := map[string][]string{}
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		query[name] = append(query[name], value)
+	}
+
+	return events.ALBTargetGroupRequest{
+		HTTPMethod:                      r.Method,
+		Path:                            r.URL.EscapedPath(),
+		MultiValueQueryStringParameters: query,
+		MultiValueHeaders:               headers,
+		RequestContext: events.ALBTargetGroupRequestContext{
+			ELB: events.ELBContext{
+				TargetGroupArn: "arn:aws:elasticloadbalancing:us-east-1:000000000000:targetgroup/local/0000000000000000",
+			},
+		},
+		Body:            body,
+		IsBase64Encoded: isBase64Encoded,
+	}, nil
+}
+
+// WriteALBTargetGroupResponse writes res to w as an Application Load Balancer
+// would.
+func WriteALBTargetGroupResponse(w http.ResponseWriter, res events.ALBTargetGroupResponse) error {
+	writeEventHeaders(w, res.Headers, res.MultiValueHeaders)
+
+	status := res.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return writeEventBody(w, status, res.Body, res.IsBase64Encoded)
+}
+
+// NewAPIGatewayV1Request synthesizes the event API Gateway (REST API) would
+// deliver for r, with every path matched by a {proxy+} resource on a "local"
+// stage.
+func NewAPIGatewayV1Request(r *http.Request) (events.APIGatewayProxyRequest, error) {
+	body, isBase64Encoded, err := readEventBody(r)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	headers := map[string]string{}
+	multiHeaders := map[string][]string{}
+	for name, values := range r.Header {
+		headers[name] = values[len(values)-1]
+		multiHeaders[name] = values
+	}
+	headers["Host"] = r.Host
+	multiHeaders["Host"] = []string{r.Host}
+	for name, value := range forwardedHeaders(r) {
+		name = http.CanonicalHeaderKey(name)
+		headers[name] = value
+		multiHeaders[name] = []string{value}
+	}
+
+	var query map[string]string
+	var multiQuery map[string][]string
+	if values := r.URL.Query(); len(values) > 0 {
+		query = make(map[string]string, len(values))
+		multiQuery = values
+		for name, v := range values {
+			query[name] = v[len(v)-1]
+		}
+	}
+
+	now := time.Now()
+	return events.APIGatewayProxyRequest{
+		Resource:                        "/{proxy+}",
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         headers,
+		MultiValueHeaders:               multiHeaders,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: multiQuery,
+		PathParameters:                  map[string]string{"proxy": strings.TrimPrefix(r.URL.Path, "/")},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:    "000000000000",
+			ResourceID:   "local",
+			Stage:        "local",
+			DomainName:   r.Host,
+			DomainPrefix: strings.Split(r.Host, ".")[0],
+			RequestID:    uuid.NewString(),
+			Protocol:     r.Proto,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  remoteIP(r),
+				UserAgent: r.UserAgent(),
+			},
+			ResourcePath:     "/{proxy+}",
+			Path:             r.URL.Path,
+			HTTPMethod:       r.Method,
+			RequestTime:      now.UTC().Format("02/Jan/2006:15:04:05 -0700"),
+			RequestTimeEpoch: now.UnixMilli(),
+			APIID:            "local",
+		},
+		Body:            body,
+		IsBase64Encoded: isBase64Encoded,
+	}, nil
+}
+
+// WriteAPIGatewayV1Response writes res to w as API Gateway would.
+func WriteAPIGatewayV1Response(w http.ResponseWriter, res events.APIGatewayProxyResponse) error {
+	writeEventHeaders(w, res.Headers, res.MultiValueHeaders)
+
+	status := res.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return writeEventBody(w, status, res.Body, res.IsBase64Encoded)
+}
+
+// NewFunctionURLRequest synthesizes the event a Function URL would deliver for
+// r.
+func NewFunctionURLRequest(r *http.Request) (events.LambdaFunctionURLRequest, error) {
+	evt, err := NewAPIGatewayV2Request(r)
+	if err != nil {
+		return events.LambdaFunctionURLRequest{}, err
+	}
+
+	rc := evt.RequestContext
+	return events.LambdaFunctionURLRequest{
+		Version:               evt.Version,
+		RawPath:               evt.RawPath,
+		RawQueryString:        evt.RawQueryString,
+		Cookies:               evt.Cookies,
+		Headers:               evt.Headers,
+		QueryStringParameters: evt.QueryStringParameters,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			AccountID:    rc.AccountID,
+			RequestID:    rc.RequestID,
+			APIID:        rc.APIID,
+			DomainName:   rc.DomainName,
+			DomainPrefix: rc.DomainPrefix,
+			Time:         rc.Time,
+			TimeEpoch:    rc.TimeEpoch,
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+				Method:    rc.HTTP.Method,
+				Path:      rc.HTTP.Path,
+				Protocol:  rc.HTTP.Protocol,
+				SourceIP:  rc.HTTP.SourceIP,
+				UserAgent: rc.HTTP.UserAgent,
+			},
+		},
+		Body:            evt.Body,
+		IsBase64Encoded: evt.IsBase64Encoded,
+	}, nil
+}
+
+// WriteFunctionURLStreamingResponse writes res to w as a Function URL with
+// InvokeMode RESPONSE_STREAM would, flushing the body as it's read.
+func WriteFunctionURLStreamingResponse(w http.ResponseWriter, res *events.LambdaFunctionURLStreamingResponse) error {
+	for name, value := range res.Headers {
+		w.Header().Set(name, value)
+	}
+	for _, cookie := range res.Cookies {
+		w.Header().Add("Set-Cookie", cookie)
+	}
+
+	status := res.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if res.Body == nil {
+		return nil
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read response body: %w", err)
+		}
+	}
+}
+
+func writeEventHeaders(w http.ResponseWriter, headers map[string]string, multiHeaders map[string][]string) {
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range multiHeaders {
+		w.Header().Del(name)
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+}
+
+// forwardedHeaders returns the headers API Gateway and ALB add to requests.
+func forwardedHeaders(r *http.Request) map[string]string {
+	proto, port := "http", "80"
+	if r.TLS != nil {
+		proto, port = "https", "443"
+	}
+	if _, p, err := net.SplitHostPort(r.Host); err == nil {
+		port = p
+	}
+
+	return map[string]string{
+		"x-forwarded-for":   remoteIP(r),
+		"x-forwarded-proto": proto,
+		"x-forwarded-port":  port,
+	}
+}
+
+// readEventBody reads the body of r as Lambda events carry it, base64 encoded
+// unless it is text.
+func readEventBody(r *http.Request) (string, bool, error) {
+	if r.Body == nil {
+		return "", false, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read request body: %w", err)
+	}
+	if utf8.Valid(data) {
+		return string(data), false, nil
+	}
+	return base64.StdEncoding.EncodeToString(data), true, nil
+}
+
+func writeEventBody(w http.ResponseWriter, status int, body string, isBase64Encoded bool) error {
+	data := []byte(body)
+	if isBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return fmt.Errorf("unable to decode response body: %w", err)
+		}
+		data = decoded
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	_, err := w.Write(data)
+	return err
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
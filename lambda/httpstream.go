@@ -0,0 +1,190 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	lambdaproxy "github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/code-inbox/mason-go/internal/logging"
+)
+
+// FunctionURLStreamHandler routes the lambda request (from a Function URL with
+// InvokeMode RESPONSE_STREAM) to an internal endpoint, and streams the response
+// back as the app writes it. The status and headers are sent on the first
+// Write or Flush, so server-sent events reach the client as they're flushed.
+//
+// Streaming responses require the provided.al2 runtime, or building with
+// `-tags lambda.norpc`.
+func (l HTTP) FunctionURLStreamHandler(ctx context.Context, request events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLStreamingResponse, error) {
+	var ra lambdaproxy.RequestAccessorV2
+
+	r, err := ra.EventToRequestWithContext(ctx, toAPIGatewayV2Request(request))
+	if err != nil {
+		logging.OrDiscard(l.Logger).Error("event to request failed", "requestID", request.RequestContext.RequestID, "err", err)
+		return nil, fmt.Errorf("event to request: %w", err)
+	}
+
+	w := newStreamingResponseWriter()
+	go w.serve(l.App, r, logging.OrDiscard(l.Logger))
+
+	select {
+	case <-w.ready:
+	case <-ctx.Done():
+		w.body.PipeReader.Close()
+		return nil, ctx.Err()
+	}
+
+	return w.response(), nil
+}
+
+// streamingResponseWriter is an http.ResponseWriter that pipes the body to the
+// streaming response. The status and headers are captured once, when the app
+// first writes or flushes.
+type streamingResponseWriter struct {
+	header http.Header
+	status int
+	sent   http.Header
+	ready  chan struct{} // closed once status and sent are final
+	done   chan struct{} // closed once the app returns
+	pw     *io.PipeWriter
+	body   *streamingBody
+}
+
+func newStreamingResponseWriter() *streamingResponseWriter {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	return &streamingResponseWriter{
+		header: http.Header{},
+		ready:  make(chan struct{}),
+		done:   done,
+		pw:     pw,
+		body:   &streamingBody{PipeReader: pr, done: done},
+	}
+}
+
+func (w *streamingResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *streamingResponseWriter) WriteHeader(status int) {
+	if w.status != 0 || status < http.StatusOK {
+		return
+	}
+	w.status = status
+	w.sent = w.header.Clone()
+	close(w.ready)
+}
+
+func (w *streamingResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.pw.Write(p)
+}
+
+// Flush sends the status and headers. Writes aren't buffered, so there's
+// nothing else to flush.
+func (w *streamingResponseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (w *streamingResponseWriter) serve(app http.Handler, r *http.Request, logger *slog.Logger) {
+	defer close(w.done)
+	defer func() {
+		if v := recover(); v != nil {
+			logger.Error("handler panicked", "path", r.URL.Path, "err", v)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.pw.CloseWithError(fmt.Errorf("handler panicked: %v", v))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.pw.Close()
+	}()
+
+	app.ServeHTTP(w, r)
+}
+
+func (w *streamingResponseWriter) response() *events.LambdaFunctionURLStreamingResponse {
+	headers := map[string]string{}
+	var cookies []string
+	for name, values := range w.sent {
+		if name == "Set-Cookie" {
+			cookies = append(cookies, values...)
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	return &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: w.status,
+		Headers:    headers,
+		Cookies:    cookies,
+		Body:       w.body,
+	}
+}
+
+// streamingBody is the read side of the pipe. Closing it fails the app's
+// pending writes, and waits for the app to return so it can't outlive the
+// invocation.
+type streamingBody struct {
+	*io.PipeReader
+	done <-chan struct{}
+}
+
+func (b *streamingBody) Close() error {
+	err := b.PipeReader.Close()
+	<-b.done
+	return err
+}
+
+// toAPIGatewayV2Request converts a Function URL request to the API Gateway
+// HTTP API event it mirrors.
+func toAPIGatewayV2Request(request events.LambdaFunctionURLRequest) events.APIGatewayV2HTTPRequest {
+	var authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription
+	if a := request.RequestContext.Authorizer; a != nil && a.IAM != nil {
+		authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			IAM: &events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{
+				AccessKey: a.IAM.AccessKey,
+				AccountID: a.IAM.AccountID,
+				CallerID:  a.IAM.CallerID,
+				UserARN:   a.IAM.UserARN,
+				UserID:    a.IAM.UserID,
+			},
+		}
+	}
+
+	rc := request.RequestContext
+	return events.APIGatewayV2HTTPRequest{
+		Version:               request.Version,
+		RouteKey:              "$default",
+		RawPath:               request.RawPath,
+		RawQueryString:        request.RawQueryString,
+		Cookies:               request.Cookies,
+		Headers:               request.Headers,
+		QueryStringParameters: request.QueryStringParameters,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:     "$default",
+			AccountID:    rc.AccountID,
+			Stage:        "$default",
+			RequestID:    rc.RequestID,
+			Authorizer:   authorizer,
+			APIID:        rc.APIID,
+			DomainName:   rc.DomainName,
+			DomainPrefix: rc.DomainPrefix,
+			Time:         rc.Time,
+			TimeEpoch:    rc.TimeEpoch,
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    rc.HTTP.Method,
+				Path:      rc.HTTP.Path,
+				Protocol:  rc.HTTP.Protocol,
+				SourceIP:  rc.HTTP.SourceIP,
+				UserAgent: rc.HTTP.UserAgent,
+			},
+		},
+		Body:            request.Body,
+		IsBase64Encoded: request.IsBase64Encoded,
+	}
+}
@@ -0,0 +1,451 @@
+// Package lambdalocal emulates the Lambda Runtime API so that unmodified Lambda
+// handler binaries run locally, fed with DynamoDB stream batches from a
+// listener.Subscriber and with requests from a local HTTP listener.
+//
+//	runtime := lambdalocal.New(lambdalocal.WithTimeout(10 * time.Second))
+//	go runtime.Run(ctx, "./bin/handler")
+//
+//	sub, err := stream.Subscribe(ctx, runtime)
+//	// or
+//	http.ListenAndServe(":8080", runtime.HTTPHandler())
+package lambdalocal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+	"github.com/code-inbox/mason-go/internal/logging"
+	"github.com/code-inbox/mason-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultFunctionName = "local"
+	defaultMemorySize   = 128
+	defaultTimeout      = 3 * time.Second
+
+	apiPrefix = "/2018-06-01/runtime/"
+)
+
+type options struct {
+	functionName string
+	memorySize   int
+	timeout      time.Duration
+	logger       *slog.Logger
+}
+
+type Option func(*options)
+
+// WithFunctionName sets the name the function is invoked as. Defaults to
+// "local".
+func WithFunctionName(name string) Option {
+	return func(o *options) {
+		o.functionName = name
+	}
+}
+
+// WithMemorySize sets the memory, in MB, reported to the function. Go
+// binaries are also given a matching soft memory limit, GOMEMLIMIT. Defaults
+// to 128.
+func WithMemorySize(mb int) Option {
+	return func(o *options) {
+		o.memorySize = mb
+	}
+}
+
+// WithTimeout sets how long an invocation may run before it fails and the
+// function is restarted. Defaults to 3 seconds, as in Lambda.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithLogger sets the logger used by the runtime. By default nothing is
+// logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// FunctionError is an error reported by the function.
+type FunctionError struct {
+	Type    string `json:"errorType"`
+	Message string `json:"errorMessage"`
+}
+
+func (e *FunctionError) Error() string {
+	if e.Type == "" {
+		return e.Message
+	}
+	return e.Type + ": " + e.Message
+}
+
+// TimeoutError reports an invocation that did not complete in time.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("task timed out after %v", e.Timeout)
+}
+
+// Runtime serves the Lambda Runtime API to a single function process and
+// invokes it one event at a time.
+type Runtime struct {
+	options  options
+	next     chan *invocation
+	timeouts chan struct{}
+	mutex    sync.Mutex
+	inflight map[string]*invocation
+}
+
+type invocation struct {
+	requestID string
+	payload   []byte
+	done      chan result
+	abandoned bool // guarded by Runtime.mutex
+}
+
+type result struct {
+	payload []byte
+	err     error
+}
+
+func New(opts ...Option) *Runtime {
+	options := options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.functionName == "" {
+		options.functionName = defaultFunctionName
+	}
+	if options.memorySize <= 0 {
+		options.memorySize = defaultMemorySize
+	}
+	if options.timeout <= 0 {
+		options.timeout = defaultTimeout
+	}
+	options.logger = logging.OrDiscard(options.logger)
+
+	return &Runtime{
+		options:  options,
+		next:     make(chan *invocation),
+		timeouts: make(chan struct{}, 1),
+		inflight: map[string]*invocation{},
+	}
+}
+
+// Invoke delivers payload to the function and returns its response. The
+// timeout starts once the function has received the event. Errors reported by
+// the function are returned as a *FunctionError, timeouts as a *TimeoutError.
+func (r *Runtime) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	inv := &invocation{
+		requestID: uuid.NewString(),
+		payload:   payload,
+		done:      make(chan result, 1),
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r.next <- inv:
+	}
+
+	timer := time.NewTimer(r.options.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		r.abandon(inv)
+		return nil, ctx.Err()
+
+	case res := <-inv.done:
+		return res.payload, res.err
+
+	case <-timer.C:
+		r.abandon(inv)
+		r.options.logger.Warn("invocation timed out", "requestID", inv.requestID, "timeout", r.options.timeout)
+		select {
+		case r.timeouts <- struct{}{}:
+		default:
+		}
+		return nil, &TimeoutError{Timeout: r.options.timeout}
+	}
+}
+
+// Process implements ddbstream.Processor, so a listener.Subscriber can feed
+// stream batches to the function as Lambda would.
+func (r *Runtime) Process(ctx context.Context, batch ddbstream.Batch) (events.DynamoDBEventResponse, error) {
+	evt := events.DynamoDBEvent{
+		Records: make([]events.DynamoDBEventRecord, 0, len(batch.Records)),
+	}
+	for _, record := range batch.Records {
+		evt.Records = append(evt.Records, ddbstream.ToEventRecord(batch.StreamARN, record))
+	}
+
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return events.DynamoDBEventResponse{}, fmt.Errorf("unable to marshal event: %w", err)
+	}
+
+	out, err := r.Invoke(ctx, payload)
+	if err != nil {
+		return events.DynamoDBEventResponse{}, err
+	}
+
+	// functions that return anything other than a batch response succeeded
+	var response events.DynamoDBEventResponse
+	_ = json.Unmarshal(out, &response)
+	return response, nil
+}
+
+// HTTPHandler returns a handler that invokes the function with each request,
+// as a Function URL would, with an API Gateway (payload version 2.0) event.
+func (r *Runtime) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		evt, err := lambda.NewAPIGatewayV2Request(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		payload, err := json.Marshal(evt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		out, err := r.Invoke(req.Context(), payload)
+		if err != nil {
+			r.options.logger.Error("invocation failed", "method", req.Method, "path", req.URL.Path, "err", err)
+			status := http.StatusBadGateway
+			if timeout := (*TimeoutError)(nil); errors.As(err, &timeout) {
+				status = http.StatusGatewayTimeout
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		var res events.APIGatewayV2HTTPResponse
+		if err := json.Unmarshal(out, &res); err != nil {
+			r.options.logger.Error("invalid response", "method", req.Method, "path", req.URL.Path, "err", err)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+		if err := lambda.WriteAPIGatewayV2Response(w, res); err != nil {
+			r.options.logger.Error("write response failed", "method", req.Method, "path", req.URL.Path, "err", err)
+		}
+	})
+}
+
+// ServeHTTP serves the Runtime API. Functions find it through the
+// AWS_LAMBDA_RUNTIME_API environment variable.
+func (r *Runtime) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, apiPrefix)
+	switch {
+	case req.Method == http.MethodGet && path == "invocation/next":
+		r.serveNext(w, req)
+
+	case req.Method == http.MethodPost && strings.HasPrefix(path, "invocation/"):
+		parts := strings.Split(strings.TrimPrefix(path, "invocation/"), "/")
+		if len(parts) != 2 || (parts[1] != "response" && parts[1] != "error") {
+			http.NotFound(w, req)
+			return
+		}
+		r.serveResult(w, req, parts[0], parts[1] == "error")
+
+	case req.Method == http.MethodPost && path == "init/error":
+		data, _ := io.ReadAll(req.Body)
+		r.options.logger.Error("function failed to initialize", "err", strings.TrimSpace(string(data)))
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *Runtime) serveNext(w http.ResponseWriter, req *http.Request) {
+	var inv *invocation
+	for inv == nil {
+		select {
+		case <-req.Context().Done():
+			return
+		case inv = <-r.next:
+		}
+
+		// the caller may have given up on the invocation since handing it over
+		r.mutex.Lock()
+		if inv.abandoned {
+			inv = nil
+		} else {
+			r.inflight[inv.requestID] = inv
+		}
+		r.mutex.Unlock()
+	}
+
+	deadline := time.Now().Add(r.options.timeout)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Lambda-Runtime-Aws-Request-Id", inv.requestID)
+	w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(deadline.UnixMilli(), 10))
+	w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", r.functionARN())
+	w.Header().Set("Lambda-Runtime-Trace-Id", "Root="+uuid.NewString())
+	w.Write(inv.payload)
+
+	r.options.logger.Debug("invocation started", "requestID", inv.requestID)
+}
+
+func (r *Runtime) serveResult(w http.ResponseWriter, req *http.Request, requestID string, failed bool) {
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the result of an invocation that timed out or was cancelled is dropped,
+	// but accepted, since the runtime client exits when a result is rejected
+	inv := r.forget(requestID)
+	if inv == nil {
+		r.options.logger.Warn("result of abandoned invocation dropped", "requestID", requestID, "failed", failed)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	res := result{payload: data}
+	if failed {
+		fnErr := &FunctionError{Type: req.Header.Get("Lambda-Runtime-Function-Error-Type")}
+		if err := json.Unmarshal(data, fnErr); err != nil {
+			fnErr.Message = string(data)
+		}
+		res = result{err: fnErr}
+	}
+	inv.done <- res
+
+	r.options.logger.Debug("invocation completed", "requestID", requestID, "failed", failed)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// forget removes an invocation in flight, returning it if it was.
+func (r *Runtime) forget(requestID string) *invocation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	inv := r.inflight[requestID]
+	delete(r.inflight, requestID)
+	return inv
+}
+
+// abandon forgets an invocation its caller no longer waits for, whether or not
+// the function has received it yet.
+func (r *Runtime) abandon(inv *invocation) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	inv.abandoned = true
+	delete(r.inflight, inv.requestID)
+}
+
+// failInflight fails every invocation in flight with err.
+func (r *Runtime) failInflight(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for requestID, inv := range r.inflight {
+		inv.done <- result{err: err}
+		delete(r.inflight, requestID)
+	}
+}
+
+func (r *Runtime) functionARN() string {
+	return fmt.Sprintf("arn:aws:lambda:%v:000000000000:function:%v", region(), r.options.functionName)
+}
+
+// Env returns the environment a function process expects, given the address
+// the Runtime API is served on.
+func (r *Runtime) Env(addr string) []string {
+	return []string{
+		"AWS_LAMBDA_RUNTIME_API=" + addr,
+		"AWS_LAMBDA_FUNCTION_NAME=" + r.options.functionName,
+		"AWS_LAMBDA_FUNCTION_VERSION=$LATEST",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE=" + strconv.Itoa(r.options.memorySize),
+		"AWS_LAMBDA_LOG_GROUP_NAME=/aws/lambda/" + r.options.functionName,
+		"AWS_LAMBDA_LOG_STREAM_NAME=local",
+		"AWS_REGION=" + region(),
+		"GOMEMLIMIT=" + strconv.Itoa(r.options.memorySize) + "MiB",
+	}
+}
+
+// Run serves the Runtime API on a local port and runs the function binary at
+// path against it until ctx is done. The function is restarted when it exits
+// or an invocation times out.
+func (r *Runtime) Run(ctx context.Context, path string, args ...string) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("unable to listen: %w", err)
+	}
+
+	server := &http.Server{Handler: r}
+	go server.Serve(ln)
+	defer server.Close()
+
+	env := append(os.Environ(), r.Env(ln.Addr().String())...)
+	for {
+		cmd := exec.Command(path, args...)
+		cmd.Env = env
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("unable to start function, %v: %w", path, err)
+		}
+		r.options.logger.Info("function started", "path", path, "pid", cmd.Process.Pid)
+
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+			<-exited
+			return nil
+
+		case <-r.timeouts:
+			r.options.logger.Info("restarting function after timeout", "path", path)
+			cmd.Process.Kill()
+			<-exited
+
+		case err := <-exited:
+			r.options.logger.Warn("function exited, restarting", "path", path, "err", err)
+			r.failInflight(&FunctionError{Type: "Runtime.ExitError", Message: fmt.Sprintf("runtime exited: %v", err)})
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func region() string {
+	if v := os.Getenv("AWS_REGION"); v != "" {
+		return v
+	}
+	return "us-east-1"
+}
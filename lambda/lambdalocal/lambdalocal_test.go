@@ -0,0 +1,214 @@
+package lambdalocal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/code-inbox/mason-go/ddb/ddbstream"
+)
+
+// serveFunction plays the part of a function process, answering one
+// invocation with fn.
+func serveFunction(t *testing.T, api string, fn func(payload []byte) (path string, body []byte)) {
+	t.Helper()
+
+	res, err := http.Get(api + "/2018-06-01/runtime/invocation/next")
+	if err != nil {
+		t.Errorf("got %v; want nil", err)
+		return
+	}
+	defer res.Body.Close()
+
+	payload, _ := io.ReadAll(res.Body)
+	if res.Header.Get("Lambda-Runtime-Deadline-Ms") == "" {
+		t.Errorf("got no deadline; want deadline")
+	}
+
+	requestID := res.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	path, body := fn(payload)
+	out, err := http.Post(api+"/2018-06-01/runtime/invocation/"+requestID+"/"+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Errorf("got %v; want nil", err)
+		return
+	}
+	out.Body.Close()
+	if out.StatusCode != http.StatusAccepted {
+		t.Errorf("got %v; want %v", out.StatusCode, http.StatusAccepted)
+	}
+}
+
+func TestRuntime_Invoke(t *testing.T) {
+	ctx := context.Background()
+	runtime := New()
+	api := httptest.NewServer(runtime)
+	defer api.Close()
+
+	t.Run("response", func(t *testing.T) {
+		go serveFunction(t, api.URL, func(payload []byte) (string, []byte) {
+			return "response", payload
+		})
+
+		got, err := runtime.Invoke(ctx, []byte(`"hello"`))
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		if want := `"hello"`; string(got) != want {
+			t.Fatalf("got %v; want %v", string(got), want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		go serveFunction(t, api.URL, func([]byte) (string, []byte) {
+			return "error", []byte(`{"errorType": "errorString", "errorMessage": "boom"}`)
+		})
+
+		_, err := runtime.Invoke(ctx, []byte(`{}`))
+		var fnErr *FunctionError
+		if !errors.As(err, &fnErr) || fnErr.Message != "boom" {
+			t.Fatalf("got %v; want boom", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		runtime := New(WithTimeout(10 * time.Millisecond))
+		api := httptest.NewServer(runtime)
+		defer api.Close()
+
+		go http.Get(api.URL + "/2018-06-01/runtime/invocation/next")
+
+		_, err := runtime.Invoke(ctx, []byte(`{}`))
+		var timeout *TimeoutError
+		if !errors.As(err, &timeout) {
+			t.Fatalf("got %v; want timeout", err)
+		}
+	})
+
+	t.Run("late response", func(t *testing.T) {
+		runtime := New(WithTimeout(10 * time.Millisecond))
+		api := httptest.NewServer(runtime)
+		defer api.Close()
+
+		// the response is accepted after the timeout, so the function carries on
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			serveFunction(t, api.URL, func(payload []byte) (string, []byte) {
+				time.Sleep(50 * time.Millisecond)
+				return "response", payload
+			})
+		}()
+
+		_, err := runtime.Invoke(ctx, []byte(`{}`))
+		var timeout *TimeoutError
+		if !errors.As(err, &timeout) {
+			t.Fatalf("got %v; want timeout", err)
+		}
+		<-served
+	})
+
+	t.Run("abandoned before it's received", func(t *testing.T) {
+		runtime := New()
+		api := httptest.NewServer(runtime)
+		defer api.Close()
+
+		abandoned := &invocation{requestID: "1", done: make(chan result, 1)}
+		runtime.abandon(abandoned)
+		go func() {
+			runtime.next <- abandoned
+			runtime.next <- &invocation{requestID: "2", payload: []byte(`{}`), done: make(chan result, 1)}
+		}()
+
+		res, err := http.Get(api.URL + "/2018-06-01/runtime/invocation/next")
+		if err != nil {
+			t.Fatalf("got %v; want nil", err)
+		}
+		res.Body.Close()
+		if got, want := res.Header.Get("Lambda-Runtime-Aws-Request-Id"), "2"; got != want {
+			t.Fatalf("got %v; want %v", got, want)
+		}
+
+		runtime.mutex.Lock()
+		defer runtime.mutex.Unlock()
+		if _, ok := runtime.inflight["1"]; ok {
+			t.Fatalf("got abandoned invocation in flight; want forgotten")
+		}
+	})
+}
+
+func TestRuntime_Process(t *testing.T) {
+	runtime := New()
+	api := httptest.NewServer(runtime)
+	defer api.Close()
+
+	go serveFunction(t, api.URL, func(payload []byte) (string, []byte) {
+		var evt events.DynamoDBEvent
+		if err := json.Unmarshal(payload, &evt); err != nil {
+			t.Errorf("got %v; want nil", err)
+		}
+		response := events.DynamoDBEventResponse{
+			BatchItemFailures: []events.DynamoDBBatchItemFailure{{ItemIdentifier: evt.Records[0].Change.SequenceNumber}},
+		}
+		data, _ := json.Marshal(response)
+		return "response", data
+	})
+
+	batch := ddbstream.Batch{
+		Metadata: ddbstream.Metadata{StreamARN: "arn"},
+		Records: []*types.Record{{
+			EventID: aws.String("1"),
+			Dynamodb: &types.StreamRecord{
+				Keys:           map[string]types.AttributeValue{"PK": &types.AttributeValueMemberS{Value: "User#1"}},
+				SequenceNumber: aws.String("100"),
+			},
+		}},
+	}
+	response, err := runtime.Process(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("got %v; want nil", err)
+	}
+	if want := []events.DynamoDBBatchItemFailure{{ItemIdentifier: "100"}}; !reflect.DeepEqual(response.BatchItemFailures, want) {
+		t.Fatalf("got %v; want %v", response.BatchItemFailures, want)
+	}
+}
+
+func TestRuntime_HTTPHandler(t *testing.T) {
+	runtime := New()
+	api := httptest.NewServer(runtime)
+	defer api.Close()
+
+	go serveFunction(t, api.URL, func(payload []byte) (string, []byte) {
+		var evt events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &evt); err != nil {
+			t.Errorf("got %v; want nil", err)
+		}
+		data, _ := json.Marshal(events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusCreated,
+			Headers:    map[string]string{"Content-Type": "text/plain"},
+			Body:       evt.RequestContext.HTTP.Method + " " + evt.RawPath + "?" + evt.RawQueryString + " " + evt.Body,
+		})
+		return "response", data
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users?name=a", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	runtime.HTTPHandler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %v; want %v", w.Code, http.StatusCreated)
+	}
+	if got, want := w.Body.String(), "POST /users?name=a hello"; got != want {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}